@@ -0,0 +1,133 @@
+// Package archive walks the entries of the archives that packages are
+// downloaded as.
+//
+// The type of an archive is detected from its contents, and each type has
+// an Extractor registered for it. Compressed archives, ie: .tar.gz, are
+// decompressed and the archive inside is detected and walked in turn.
+package archive
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// EntryType is the kind of an entry in an archive.
+type EntryType int
+
+const (
+	TypeFile EntryType = iota
+	TypeDir
+	TypeSymlink
+	TypeHardlink
+	// TypeOther is anything else, ie: devices and fifos.
+	TypeOther
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case TypeFile:
+		return "file"
+	case TypeDir:
+		return "dir"
+	case TypeSymlink:
+		return "symlink"
+	case TypeHardlink:
+		return "hardlink"
+	}
+	return "other"
+}
+
+// Entry is a file, directory or link in an archive.
+type Entry struct {
+	// Name is the path of the entry in the archive. It is empty for a
+	// Decompressed entry.
+	Name string
+	Type EntryType
+	// Decompressed is set for the single entry of a compressed file that
+	// isn't an archive, ie: a gzipped binary.
+	Decompressed bool
+	// Mode is the permission bits of the entry, including the setuid,
+	// setgid and sticky bits.
+	Mode os.FileMode
+	// Size is the uncompressed size, or -1 if it isn't known.
+	Size    int64
+	ModTime time.Time
+	// Linkname is the target of a symlink or hardlink.
+	Linkname string
+}
+
+// FileInfo returns the entry as an os.FileInfo, named by the base name of
+// the entry.
+func (e *Entry) FileInfo() os.FileInfo {
+	return entryInfo{e}
+}
+
+type entryInfo struct {
+	e *Entry
+}
+
+func (fi entryInfo) Name() string       { return path.Base(fi.e.Name) }
+func (fi entryInfo) Size() int64        { return fi.e.Size }
+func (fi entryInfo) ModTime() time.Time { return fi.e.ModTime }
+func (fi entryInfo) IsDir() bool        { return fi.e.Type == TypeDir }
+func (fi entryInfo) Sys() interface{}   { return fi.e }
+
+func (fi entryInfo) Mode() os.FileMode {
+	mode := fi.e.Mode
+	switch fi.e.Type {
+	case TypeDir:
+		mode |= os.ModeDir
+	case TypeSymlink:
+		mode |= os.ModeSymlink
+	case TypeOther:
+		mode |= os.ModeIrregular
+	}
+	return mode
+}
+
+// WalkFunc is called for every entry in an archive, r reads the contents
+// of the entry and is only valid until WalkFunc returns.
+type WalkFunc func(e *Entry, r io.Reader) error
+
+// Extractor walks the entries of one type of archive.
+type Extractor interface {
+	Walk(ctx context.Context, r io.Reader, limit *SizeLimit, fn WalkFunc) error
+}
+
+// extractors are keyed by the type returned from Detect.
+var extractors = map[string]Extractor{}
+
+// Register makes an extractor available for archives detected as typ.
+func Register(typ string, e Extractor) {
+	extractors[typ] = e
+}
+
+// Walk detects the type of the archive read from r and calls fn for each
+// of its entries, stopping at the first error. It fails with a *SizeError
+// once more than limit is decompressed, a nil limit is no limit.
+func Walk(ctx context.Context, r io.Reader, limit *SizeLimit, fn WalkFunc) error {
+	typ, br := Peek(r)
+	e, ok := extractors[typ]
+	if !ok {
+		if typ == "" {
+			return fmt.Errorf("unsupported archive, unable to detect its type")
+		}
+		return fmt.Errorf("unsupported archive %s", typ)
+	}
+	return e.Walk(ctx, br, limit, fn)
+}
+
+// Peek detects the type of the archive read from r, reading only as much
+// of it as Detect needs. The returned reader still reads all of r.
+func Peek(r io.Reader) (string, io.Reader) {
+	br := bufio.NewReaderSize(r, detectSize)
+	// Archives smaller than detectSize return an error, but still
+	// return everything there is.
+	head, _ := br.Peek(detectSize)
+	return Detect(head), br
+}
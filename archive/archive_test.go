@@ -0,0 +1,188 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// walkFile walks an archive in testdata, returning the contents of each
+// regular file and the type of every other entry.
+func walkFile(t *testing.T, name string) map[string]string {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got := map[string]string{}
+	err = Walk(context.Background(), f, nil, func(e *Entry, r io.Reader) error {
+		if e.Type != TypeFile {
+			got[e.Name] = e.Type.String()
+			return nil
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		got[e.Name] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return got
+}
+
+func TestWalk(t *testing.T) {
+	want := map[string]string{
+		"hello/":          "dir",
+		"hello/bin/":      "dir",
+		"hello/bin/hello": "hello\n",
+		"hello/README":    "readme\n",
+	}
+	for _, name := range []string{"hello.tar", "hello.tar.gz", "hello.tar.bz2", "hello.tar.xz", "hello.tar.zst", "hello.zip", "hello.deb", "hello.rpm"} {
+		got := walkFile(t, name)
+		if len(got) != len(want) {
+			t.Errorf("%s: got entries %v, want %v", name, got, want)
+			continue
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %q, want %q", name, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestWalkCompressedFile(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "hello.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []*Entry
+	err = Walk(context.Background(), bytes.NewReader(b), nil, func(e *Entry, r io.Reader) error {
+		entries = append(entries, e)
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if string(b) != "hello\n" {
+			t.Errorf("got contents %q, want %q", b, "hello\n")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !entries[0].Decompressed || entries[0].Type != TypeFile {
+		t.Fatalf("got entries %+v, want a single decompressed file", entries)
+	}
+}
+
+func TestWalkUnsupported(t *testing.T) {
+	err := Walk(context.Background(), strings.NewReader("not an archive"), nil, func(*Entry, io.Reader) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an error walking an unknown archive")
+	}
+}
+
+func TestWalkCancelled(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "hello.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Walk(ctx, bytes.NewReader(b), nil, func(*Entry, io.Reader) error {
+		t.Fatal("walked an entry after being cancelled")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestWalkCpioLongName(t *testing.T) {
+	// A "new ascii" cpio header, with a name size of 0x7fffffff.
+	hdr := "070701" + strings.Repeat("00000000", 11) + "7fffffff" + "00000000"
+	err := Walk(context.Background(), strings.NewReader(hdr), nil, func(*Entry, io.Reader) error {
+		t.Fatal("walked an entry with a name that is too long")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "name is") {
+		t.Fatalf("got %v, want an error for the name size", err)
+	}
+}
+
+func TestWalkCpioHardlinks(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "hello-hardlink.rpm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Only hello/bin/hi has the data, the links before and after it are
+	// walked after it.
+	var got []string
+	err = Walk(context.Background(), f, nil, func(e *Entry, r io.Reader) error {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		switch e.Type {
+		case TypeFile:
+			got = append(got, fmt.Sprintf("%s %q", e.Name, b))
+		case TypeHardlink:
+			got = append(got, fmt.Sprintf("%s => %s", e.Name, e.Linkname))
+		default:
+			got = append(got, e.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"hello/",
+		"hello/bin/",
+		`hello/bin/hi "hello\n"`,
+		"hello/bin/hello => hello/bin/hi",
+		"hello/bin/hey => hello/bin/hi",
+		`hello/README "readme\n"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %q, want %q", got, want)
+	}
+}
+
+func TestWalkSizeLimit(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "hello.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The entries aren't read, but still count towards the limit.
+	err = Walk(context.Background(), bytes.NewReader(b), &SizeLimit{Max: 1024}, func(*Entry, io.Reader) error {
+		return nil
+	})
+	if _, ok := err.(*SizeError); !ok {
+		t.Fatalf("got %v, want a *SizeError", err)
+	}
+
+	l := &SizeLimit{Max: 1 << 20}
+	if err := Walk(context.Background(), bytes.NewReader(b), l, func(*Entry, io.Reader) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	// The tar is 10240 bytes, but is only read up to its end marker.
+	if l.Used() != 4096 {
+		t.Errorf("used %d bytes, want %d", l.Used(), 4096)
+	}
+}
@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/xi2/xz"
+)
+
+func init() {
+	Register("tar", tarExtractor{})
+	Register("zip", zipExtractor{})
+	Register("deb", debExtractor{})
+	Register("rpm", rpmExtractor{})
+	Register("cpio", cpioExtractor{})
+	Register("gz", compressed(func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	}))
+	Register("xz", compressed(func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r, 0)
+	}))
+	Register("bz2", compressed(func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	}))
+	Register("zst", compressed(func(r io.Reader) (io.Reader, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}))
+}
+
+// compressed decompresses an archive and walks the archive inside of it,
+// ie: the tar in a .tar.gz. If what is compressed isn't an archive, ie: a
+// gzipped binary, it is walked as a single Decompressed entry.
+type compressed func(r io.Reader) (io.Reader, error)
+
+func (c compressed) Walk(ctx context.Context, r io.Reader, limit *SizeLimit, fn WalkFunc) error {
+	dr, err := c(r)
+	if err != nil {
+		return err
+	}
+	if closer, ok := dr.(io.Closer); ok {
+		defer closer.Close()
+	}
+	br := bufio.NewReaderSize(limitSize(limit, dr), detectSize)
+	head, err := br.Peek(detectSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if _, ok := extractors[Detect(head)]; ok {
+		return Walk(ctx, br, limit, fn)
+	}
+	// There are no permissions for a compressed file, assume that
+	// it's executable.
+	return fn(&Entry{Type: TypeFile, Mode: 0755, Size: -1, Decompressed: true}, br)
+}
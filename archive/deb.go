@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// debExtractor walks the files a Debian package installs, which are in the
+// data.tar.* member of an ar archive.
+type debExtractor struct{}
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+func (debExtractor) Walk(ctx context.Context, r io.Reader, limit *SizeLimit, fn WalkFunc) error {
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != arMagic {
+		return fmt.Errorf("invalid deb, missing ar header")
+	}
+	hdr := make([]byte, arHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, hdr); err == io.EOF {
+			return fmt.Errorf("invalid deb, no data.tar found")
+		} else if err != nil {
+			return err
+		}
+		// GNU ar terminates names with a '/'.
+		name := strings.TrimSuffix(strings.TrimSpace(string(hdr[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid deb, bad size for member %q", name)
+		}
+		member := io.LimitReader(r, size)
+		if strings.HasPrefix(name, "data.tar") {
+			return Walk(ctx, member, limit, func(e *Entry, rdr io.Reader) error {
+				if !cleanEntryName(e) {
+					return nil
+				}
+				return fn(e, rdr)
+			})
+		}
+		// Members are aligned to an even offset.
+		if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+			return err
+		}
+	}
+}
+
+// cleanEntryName removes the leading "./" that package formats put on
+// every path, so that entries can be matched like any other archive.
+// Returns false for the entry of the root directory itself.
+func cleanEntryName(e *Entry) bool {
+	e.Name = strings.TrimPrefix(e.Name, "./")
+	if e.Type == TypeHardlink {
+		// The target of a hardlink is a path in the archive too.
+		e.Linkname = strings.TrimPrefix(e.Linkname, "./")
+	}
+	return e.Name != "" && e.Name != "."
+}
@@ -0,0 +1,37 @@
+package archive
+
+import "bytes"
+
+// How much of an archive is needed to detect its type.
+const detectSize = 512
+
+var magics = []struct {
+	typ    string
+	offset int
+	magic  []byte
+}{
+	{"deb", 0, []byte("!<arch>\ndebian-binary")},
+	{"rpm", 0, []byte("\xed\xab\xee\xdb")},
+	{"cpio", 0, []byte("070701")},
+	{"cpio", 0, []byte("070702")},
+	{"zip", 0, []byte("PK\x03\x04")},
+	// An empty zip only has the end of central directory record.
+	{"zip", 0, []byte("PK\x05\x06")},
+	{"gz", 0, []byte("\x1f\x8b")},
+	{"xz", 0, []byte("\xfd7zXZ\x00")},
+	{"bz2", 0, []byte("BZh")},
+	{"zst", 0, []byte("\x28\xb5\x2f\xfd")},
+	{"tar", 257, []byte("ustar")},
+}
+
+// Detect returns the type of the archive that starts with head, or an empty
+// string if it isn't a known type.
+func Detect(head []byte) string {
+	for _, m := range magics {
+		end := m.offset + len(m.magic)
+		if len(head) >= end && bytes.Equal(head[m.offset:end], m.magic) {
+			return m.typ
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+)
+
+// SizeError is returned by Walk once more than the Max of the SizeLimit
+// passed to it has been decompressed.
+type SizeError struct {
+	Max int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("archive is larger than %d bytes uncompressed", e.Max)
+}
+
+// SizeLimit is the most bytes that walks using it can decompress between
+// them, including those of nested archives and of entries that aren't
+// read. A Max of 0 is no limit.
+type SizeLimit struct {
+	Max  int64
+	used int64
+}
+
+// Used returns how many bytes have been decompressed.
+func (l *SizeLimit) Used() int64 {
+	return l.used
+}
+
+// limitSize counts what is read from r, a decompressed stream, towards l.
+// A nil l is no limit.
+func limitSize(l *SizeLimit, r io.Reader) io.Reader {
+	if l == nil || l.Max <= 0 {
+		return r
+	}
+	return &limitedReader{l: l, r: r}
+}
+
+type limitedReader struct {
+	l *SizeLimit
+	r io.Reader
+}
+
+func (lr *limitedReader) Read(b []byte) (int, error) {
+	n, err := lr.r.Read(b)
+	lr.l.used += int64(n)
+	if lr.l.used > lr.l.Max {
+		return n, &SizeError{Max: lr.l.Max}
+	}
+	return n, err
+}
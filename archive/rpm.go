@@ -0,0 +1,232 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// rpmExtractor walks the files an RPM package installs, which are in a
+// compressed cpio archive after the rpm headers.
+type rpmExtractor struct{}
+
+const rpmLeadSize = 96
+
+var rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+
+func (rpmExtractor) Walk(ctx context.Context, r io.Reader, limit *SizeLimit, fn WalkFunc) error {
+	if _, err := io.CopyN(ioutil.Discard, r, rpmLeadSize); err != nil {
+		return fmt.Errorf("invalid rpm, short lead: %v", err)
+	}
+	// The signature header is padded to a multiple of 8 bytes, the main
+	// header that follows it isn't.
+	n, err := skipRPMHeader(r)
+	if err != nil {
+		return err
+	}
+	if pad := (8 - n%8) % 8; pad > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, pad); err != nil {
+			return err
+		}
+	}
+	if _, err := skipRPMHeader(r); err != nil {
+		return err
+	}
+	return Walk(ctx, r, limit, func(e *Entry, rdr io.Reader) error {
+		if !cleanEntryName(e) {
+			return nil
+		}
+		return fn(e, rdr)
+	})
+}
+
+// skipRPMHeader skips over an rpm header structure, returning its size.
+func skipRPMHeader(r io.Reader) (int64, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, fmt.Errorf("invalid rpm, short header: %v", err)
+	}
+	if !bytes.Equal(hdr[:4], rpmHeaderMagic) {
+		return 0, fmt.Errorf("invalid rpm, bad header magic")
+	}
+	entries := int64(binary.BigEndian.Uint32(hdr[8:12]))
+	dataSize := int64(binary.BigEndian.Uint32(hdr[12:16]))
+	size := entries*16 + dataSize
+	if _, err := io.CopyN(ioutil.Discard, r, size); err != nil {
+		return 0, fmt.Errorf("invalid rpm, short header: %v", err)
+	}
+	return 16 + size, nil
+}
+
+// cpioExtractor walks "new ascii" cpio archives, the format used for rpm
+// payloads.
+type cpioExtractor struct{}
+
+const (
+	cpioHeaderSize = 110
+	cpioTrailer    = "TRAILER!!!"
+	// cpioMaxPath bounds the names and symlink targets read into memory,
+	// it is PATH_MAX on linux.
+	cpioMaxPath = 4096
+)
+
+// cpioInode identifies a file in a cpio archive, entries for the same file
+// are hardlinks to each other.
+type cpioInode struct {
+	ino, devMajor, devMinor int64
+}
+
+func (cpioExtractor) Walk(ctx context.Context, r io.Reader, limit *SizeLimit, fn WalkFunc) error {
+	hdr := make([]byte, cpioHeaderSize)
+	// Each link to a hardlinked file has an entry, but only the last one
+	// has the data. The entries before it are held back until it is found
+	// and then walked as hardlinks to it.
+	var (
+		held     = map[cpioInode][]*Entry{}
+		heldInos []cpioInode
+		linked   = map[cpioInode]string{}
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return fmt.Errorf("invalid cpio, short header: %v", err)
+		}
+		if magic := string(hdr[:6]); magic != "070701" && magic != "070702" {
+			return fmt.Errorf("invalid cpio, unsupported format %q", magic)
+		}
+		var fields [13]int64
+		for i := range fields {
+			v, err := strconv.ParseInt(string(hdr[6+i*8:14+i*8]), 16, 64)
+			if err != nil {
+				return fmt.Errorf("invalid cpio header: %v", err)
+			}
+			fields[i] = v
+		}
+		mode, nlink, mtime, size, nameSize := fields[1], fields[4], fields[5], fields[6], fields[11]
+		if nameSize > cpioMaxPath {
+			return fmt.Errorf("invalid cpio, name is %d bytes", nameSize)
+		}
+
+		name := make([]byte, nameSize)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return err
+		}
+		// The header and name, and the data, are padded to a multiple
+		// of 4 bytes.
+		if err := skipPadding(r, cpioHeaderSize+nameSize); err != nil {
+			return err
+		}
+		e := &Entry{
+			Name:    string(bytes.TrimRight(name, "\x00")),
+			Mode:    unixMode(mode),
+			Size:    size,
+			ModTime: time.Unix(mtime, 0),
+		}
+		if e.Name == cpioTrailer {
+			// Links to a file that never had its data really are empty.
+			for _, ino := range heldInos {
+				for _, he := range held[ino] {
+					if err := fn(he, bytes.NewReader(nil)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		switch mode & 0170000 {
+		case 0100000:
+			e.Type = TypeFile
+		case 0040000:
+			// Directories are named with a trailing slash, as they are
+			// in tar and zip archives.
+			e.Type = TypeDir
+			e.Name += "/"
+		case 0120000:
+			e.Type = TypeSymlink
+		default:
+			e.Type = TypeOther
+		}
+
+		var links []*Entry
+		if e.Type == TypeFile && nlink > 1 {
+			ino := cpioInode{fields[0], fields[7], fields[8]}
+			if target, ok := linked[ino]; ok {
+				e.Type, e.Linkname, e.Size = TypeHardlink, target, 0
+			} else if size == 0 {
+				if _, ok := held[ino]; !ok {
+					heldInos = append(heldInos, ino)
+				}
+				held[ino] = append(held[ino], e)
+				continue
+			} else {
+				linked[ino] = e.Name
+				for _, he := range held[ino] {
+					he.Type, he.Linkname = TypeHardlink, e.Name
+				}
+				links = held[ino]
+				delete(held, ino)
+			}
+		}
+
+		data := io.LimitReader(r, size)
+		var err error
+		if e.Type == TypeSymlink {
+			if size > cpioMaxPath {
+				return fmt.Errorf("invalid cpio, symlink %s target is %d bytes", e.Name, size)
+			}
+			// The target of a symlink is stored as its data.
+			var target []byte
+			if target, err = ioutil.ReadAll(data); err == nil {
+				e.Linkname = string(target)
+				err = fn(e, bytes.NewReader(target))
+			}
+		} else {
+			err = fn(e, data)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(ioutil.Discard, data); err != nil {
+			return err
+		}
+		if err := skipPadding(r, size); err != nil {
+			return err
+		}
+		for _, le := range links {
+			if err := fn(le, bytes.NewReader(nil)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func skipPadding(r io.Reader, n int64) error {
+	if pad := (4 - n%4) % 4; pad > 0 {
+		_, err := io.CopyN(ioutil.Discard, r, pad)
+		return err
+	}
+	return nil
+}
+
+// unixMode converts the permission bits of a unix mode to an os.FileMode.
+func unixMode(mode int64) os.FileMode {
+	m := os.FileMode(mode) & os.ModePerm
+	if mode&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+)
+
+type tarExtractor struct{}
+
+func (tarExtractor) Walk(ctx context.Context, r io.Reader, limit *SizeLimit, fn WalkFunc) error {
+	rdr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := rdr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(tarEntry(hdr), rdr); err != nil {
+			return err
+		}
+	}
+}
+
+func tarEntry(hdr *tar.Header) *Entry {
+	e := &Entry{
+		Name:     hdr.Name,
+		Mode:     hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+		Size:     hdr.Size,
+		ModTime:  hdr.ModTime,
+		Linkname: hdr.Linkname,
+	}
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeCont:
+		e.Type = TypeFile
+	case tar.TypeDir:
+		e.Type = TypeDir
+	case tar.TypeSymlink:
+		e.Type = TypeSymlink
+	case tar.TypeLink:
+		e.Type = TypeHardlink
+	default:
+		e.Type = TypeOther
+	}
+	return e
+}
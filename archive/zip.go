@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+type zipExtractor struct{}
+
+func (zipExtractor) Walk(ctx context.Context, r io.Reader, limit *SizeLimit, fn WalkFunc) error {
+	// The zip directory is at the end of the archive, so the whole
+	// archive is needed before any entries can be read.
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	rdr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	for _, f := range rdr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := walkZipFile(f, limit, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipFile(f *zip.File, limit *SizeLimit, fn WalkFunc) error {
+	mode := f.Mode()
+	e := &Entry{
+		Name:    f.Name,
+		Mode:    mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+		Size:    int64(f.UncompressedSize64),
+		ModTime: f.Modified,
+	}
+	switch {
+	case mode.IsDir() || strings.HasSuffix(f.Name, "/"):
+		e.Type = TypeDir
+	case mode&os.ModeSymlink != 0:
+		e.Type = TypeSymlink
+	case mode.IsRegular():
+		e.Type = TypeFile
+	default:
+		e.Type = TypeOther
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	data := limitSize(limit, rc)
+	if e.Type != TypeSymlink {
+		return fn(e, data)
+	}
+	// Zip stores the target of a symlink as its contents.
+	target, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	e.Linkname = string(target)
+	return fn(e, bytes.NewReader(target))
+}
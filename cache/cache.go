@@ -1,14 +1,16 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mitchellh/go-homedir"
 
+	"github.com/vishen/pacm/httpclient"
 	"github.com/vishen/pacm/logging"
 )
 
@@ -19,11 +21,17 @@ type Cache struct {
 	Archives map[string]bool
 }
 
-func LoadCache(cachePath string) (*Cache, error) {
+// Dir returns the expanded path to the cache directory, using the
+// default cache path if cachePath is empty.
+func Dir(cachePath string) (string, error) {
 	if cachePath == "" {
 		cachePath = defaultCachePath
 	}
-	cp, err := homedir.Expand(cachePath)
+	return homedir.Expand(cachePath)
+}
+
+func LoadCache(cachePath string) (*Cache, error) {
+	cp, err := Dir(cachePath)
 	if err != nil {
 		return nil, err
 	}
@@ -40,6 +48,11 @@ func LoadCache(cachePath string) (*Cache, error) {
 
 	archives := make(map[string]bool, len(files))
 	for _, f := range files {
+		// Skip anything that isn't an archive, ie: the remote recipes
+		// directory and lock files.
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
 		archives[f.Name()] = true
 	}
 
@@ -55,22 +68,48 @@ func (c Cache) LoadArchive(filename string) ([]byte, error) {
 	return b, nil
 }
 
+// WriteArchive writes an archive to the cache. The archive is written to
+// a temporary file first so that a partially written archive is never
+// mistaken for a complete one.
 func (c Cache) WriteArchive(filename string, data []byte) error {
 	outPath := filepath.Join(c.path, filename)
-	logging.PrintCommand("writefile %s 0644", outPath)
-	return ioutil.WriteFile(outPath, data, 0644)
+	tmp, err := ioutil.TempFile(c.path, ".download-")
+	if err != nil {
+		return err
+	}
+	logging.PrintCommand("writefile %s 0644", tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	logging.PrintCommand("rename %s -> %s", tmp.Name(), outPath)
+	if err := os.Rename(tmp.Name(), outPath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	c.Archives[filename] = true
+	return nil
 }
 
-func (c Cache) DownloadAndSave(url, filename string) ([]byte, error) {
-	logging.PrintCommand("HTTP GET %s", url)
-	resp, err := http.Get(url)
+func (c Cache) DownloadAndSave(ctx context.Context, url, filename string) ([]byte, error) {
+	logging.PrintCommand("HTTP GET %s", httpclient.Redact(url))
+	resp, err := httpclient.Download(ctx, url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("invalid response code for %s: %d", url, resp.StatusCode)
+		return nil, fmt.Errorf("invalid response code for %s: %d", httpclient.Redact(url), resp.StatusCode)
 	}
 
 	b, err := ioutil.ReadAll(resp.Body)
@@ -84,6 +123,10 @@ func (c Cache) DownloadAndSave(url, filename string) ([]byte, error) {
 	return b, nil
 }
 
+func (c Cache) Path() string {
+	return c.path
+}
+
 func (c Cache) ArchiveFullPath(archive string) string {
 	return filepath.Join(c.path, archive)
 }
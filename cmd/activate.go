@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"log"
-	"runtime"
 
 	"github.com/spf13/cobra"
 )
@@ -17,18 +16,19 @@ var activateCmd = &cobra.Command{
 			fmt.Printf("need <recipe>@<version>'s to make active\n")
 			return
 		}
-		conf, err := getConfig(cmd)
+		conf, err := getLockedConfig(cmd)
 		if err != nil {
 			fmt.Printf("unable to load config: %v\n", err)
 			return
 		}
+		arch, OS := getPlatform(cmd)
 		for _, recipeAndVersion := range args {
 			pkg, err := extractAndCheckRecipeAndVersion(conf, recipeAndVersion)
 			if err != nil {
 				log.Fatal(err)
 			}
 			conf.MakePackageActive(pkg)
-			if err := conf.CreatePackagesForRecipe(pkg.RecipeName, runtime.GOARCH, runtime.GOOS); err != nil {
+			if err := conf.CreatePackagesForRecipe(rootCtx, pkg.RecipeName, arch, OS); err != nil {
 				fmt.Printf("error downloading and installing packages: %v", err)
 				return
 			}
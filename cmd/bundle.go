@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/vishen/pacm/config"
+)
+
+// bundleCmd represents the bundle command
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Export and import bundles for installing packages without network access",
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Export the config, recipes and cached archives to a bundle",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Printf("need a <file> to export the bundle to\n")
+			return
+		}
+		conf, err := getLockedConfig(cmd)
+		if err != nil {
+			fmt.Printf("unable to load config: %v\n", err)
+			return
+		}
+		platforms, _ := cmd.Flags().GetStringSlice("platform")
+		if len(platforms) == 0 {
+			arch, OS := getPlatform(cmd)
+			platforms = []string{OS + "/" + arch}
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			fmt.Printf("unable to create bundle: %v\n", err)
+			return
+		}
+		defer f.Close()
+		if err := conf.ExportBundle(rootCtx, f, platforms); err != nil {
+			fmt.Printf("unable to export bundle: %v\n", err)
+			return
+		}
+		fmt.Printf("Exported bundle to %s\n", args[0])
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a bundle into the cache and remote recipes",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Printf("need a bundle <file> to import\n")
+			return
+		}
+		activateLogLevel(cmd)
+		configPath, _ := cmd.Flags().GetString("config")
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("unable to open bundle: %v\n", err)
+			return
+		}
+		defer f.Close()
+		wait, _ := cmd.Flags().GetDuration("wait")
+		if err := config.ImportBundle(configPath, f, wait); err != nil {
+			fmt.Printf("unable to import bundle: %v\n", err)
+			return
+		}
+		fmt.Printf("Imported bundle %s, run 'pacm ensure --offline' to install\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleExportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+	bundleExportCmd.Flags().StringSlice("platform", nil, "<os>/<arch> to bundle packages for, can be repeated (defaults to the current platform)")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// changelogCmd represents the changelog command
+var changelogCmd = &cobra.Command{
+	Use:   "changelog <recipe>",
+	Short: "Release notes between the active version and a newer release",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Printf("need a <recipe> to show the changelog for\n")
+			return
+		}
+		conf, err := getConfig(cmd)
+		if err != nil {
+			fmt.Printf("unable to load config: %v\n", err)
+			return
+		}
+		r, ok := conf.FindRecipe(args[0])
+		if !ok {
+			fmt.Printf("unknown recipe %q\n", args[0])
+			return
+		}
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		prereleases, _ := cmd.Flags().GetBool("prereleases")
+		if from == "" {
+			for _, p := range conf.Packages {
+				if p.RecipeName == r.Name && p.Active {
+					from = p.Version
+				}
+			}
+			if from == "" {
+				fmt.Printf("no active package for %q, use --from to set the version to start from\n", r.Name)
+				return
+			}
+		}
+
+		rels, err := conf.ReleasesBetween(rootCtx, r, from, to, prereleases)
+		if err != nil {
+			fmt.Printf("%q: %v\n", r.Name, err)
+			return
+		}
+		if len(rels) == 0 {
+			fmt.Printf("No releases of %q newer than %s\n", r.Name, from)
+			return
+		}
+		for i, rel := range rels {
+			if i > 0 {
+				fmt.Println()
+			}
+			title := fmt.Sprintf("%s %s", r.Name, rel.TagName)
+			if !rel.PublishedAt.IsZero() {
+				title += fmt.Sprintf(" (%s)", rel.PublishedAt.Format("2006-01-02"))
+			}
+			fmt.Println(title)
+			fmt.Println(strings.Repeat("=", len(title)))
+			fmt.Println()
+			if notes := rel.Notes(); notes != "" {
+				fmt.Println(notes)
+			} else {
+				fmt.Println("No release notes.")
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(changelogCmd)
+	changelogCmd.Flags().String("from", "", "version to show release notes after (defaults to the active version)")
+	changelogCmd.Flags().String("to", "", "version to show release notes up to (defaults to the newest release)")
+	changelogCmd.Flags().Bool("prereleases", false, "include the release notes of prereleases")
+}
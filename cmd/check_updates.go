@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vishen/pacm/config"
+	"github.com/vishen/pacm/logging"
+)
+
+// checkUpdatesCmd looks up the newest releases for the update notice, it
+// is started in the background when 'check_updates' is set in the config.
+var checkUpdatesCmd = &cobra.Command{
+	Use:    "check-updates",
+	Short:  "Check for newer releases in the background",
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		activateLogLevel(cmd)
+		configPath, _ := cmd.Flags().GetString("config")
+		// Don't take any locks, this runs alongside other pacm commands
+		// and only writes to the release cache. Only use the remote
+		// recipes that are already cached, as downloading them would
+		// write to the cache.
+		conf, err := config.LoadWithOptions(rootCtx, configPath, config.LoadOptions{CachedRemotes: true})
+		if err != nil {
+			fmt.Printf("unable to load config: %v\n", err)
+			return
+		}
+		if err := conf.CheckForUpdates(rootCtx); err != nil {
+			fmt.Printf("unable to check for updates: %v\n", err)
+		}
+	},
+}
+
+// notifyUpdates prints a notice if the last update check found newer
+// releases, and starts a new check in the background if one is due. It
+// never waits on the network.
+func notifyUpdates(cmd *cobra.Command) {
+	conf := loadedConfig
+	if conf == nil || conf.CheckUpdates == 0 || cmd == checkUpdatesCmd {
+		return
+	}
+	uc := conf.LoadUpdateCheck()
+	switch n := len(conf.Outdated(uc)); {
+	case n == 1:
+		fmt.Fprintf(os.Stderr, "1 package has a newer release, run pacm outdated\n")
+	case n > 1:
+		fmt.Fprintf(os.Stderr, "%d packages have newer releases, run pacm outdated\n", n)
+	}
+	if conf.Offline || !uc.Due(conf.CheckUpdates) {
+		return
+	}
+
+	// Record the check before starting it, so that only one check is
+	// started per interval even if it fails.
+	uc.CheckedAt = time.Now()
+	if err := conf.SaveUpdateCheck(uc); err != nil {
+		logging.DebugLog("unable to save update check: %v\n", err)
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		logging.DebugLog("unable to find pacm executable: %v\n", err)
+		return
+	}
+	args := []string{"check-updates"}
+	if configPath, _ := cmd.Flags().GetString("config"); configPath != "" {
+		if abs, err := filepath.Abs(configPath); err == nil {
+			configPath = abs
+		}
+		args = append(args, "--config", configPath)
+	}
+	c := exec.Command(exe, args...)
+	detach(c)
+	logging.PrintCommand("background %s %v", exe, args)
+	if err := c.Start(); err != nil {
+		logging.DebugLog("unable to start update check: %v\n", err)
+		return
+	}
+	c.Process.Release()
+}
+
+func init() {
+	rootCmd.AddCommand(checkUpdatesCmd)
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"runtime"
 
 	"github.com/spf13/cobra"
 )
@@ -12,12 +11,12 @@ var cleanCmd = &cobra.Command{
 	Use:   "clean",
 	Short: "Clean up cached archives",
 	Run: func(cmd *cobra.Command, args []string) {
-		conf, err := getConfig(cmd)
+		conf, err := getLockedConfig(cmd)
 		if err != nil {
 			fmt.Printf("unable to load config: %v\n", err)
 			return
 		}
-		conf.RemoveUnusedCachedArchivePackages(runtime.GOARCH, runtime.GOOS)
+		conf.RemoveUnusedCachedArchivePackages()
 	},
 }
 
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"runtime"
 
 	"github.com/spf13/cobra"
 )
@@ -12,12 +11,13 @@ var ensureCmd = &cobra.Command{
 	Use:   "ensure",
 	Short: "Ensure that your binaries are up-to-date",
 	Run: func(cmd *cobra.Command, args []string) {
-		conf, err := getConfig(cmd)
+		conf, err := getLockedConfig(cmd)
 		if err != nil {
 			fmt.Printf("unable to load config: %v\n", err)
 			return
 		}
-		if err := conf.CreatePackages(runtime.GOARCH, runtime.GOOS); err != nil {
+		arch, OS := getPlatform(cmd)
+		if err := conf.CreatePackages(rootCtx, arch, OS); err != nil {
 			fmt.Printf("error downloading and installing packages: %v", err)
 			return
 		}
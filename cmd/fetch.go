@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/vishen/pacm/utils"
+)
+
+// fetchCmd represents the fetch command
+var fetchCmd = &cobra.Command{
+	Use:   "fetch <recipe>@<version> <recipe>@<version>",
+	Short: "Download packages into the cache without installing them",
+	Run: func(cmd *cobra.Command, args []string) {
+		conf, err := getLockedConfig(cmd)
+		if err != nil {
+			fmt.Printf("unable to load config: %v\n", err)
+			return
+		}
+		if conf.Offline {
+			fmt.Printf("unable to fetch packages while offline\n")
+			return
+		}
+
+		platforms, _ := cmd.Flags().GetStringSlice("platform")
+		if len(platforms) == 0 {
+			arch, OS := getPlatform(cmd)
+			platforms = []string{OS + "/" + arch}
+		}
+
+		// Default to fetching every package in the config.
+		if len(args) == 0 {
+			for _, p := range conf.Packages {
+				if p.Version == "" {
+					fmt.Printf("skipping %s, it hasn't been resolved to a version, run 'pacm update %s'\n", p, p.RecipeName)
+					continue
+				}
+				args = append(args, fmt.Sprintf("%s@%s", p.RecipeName, p.Version))
+			}
+		}
+
+		failed := 0
+		for _, platform := range platforms {
+			OS, arch, err := utils.ParsePlatform(platform)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return
+			}
+			for _, recipeAndVersion := range args {
+				recipeName, version, err := splitRecipeAndVersion(recipeAndVersion)
+				if err != nil {
+					fmt.Printf("%v\n", err)
+					return
+				}
+				downloaded, err := conf.FetchArchive(rootCtx, arch, OS, recipeName, version)
+				if err != nil {
+					fmt.Printf("unable to fetch %s for %s: %v\n", recipeAndVersion, platform, err)
+					failed++
+					continue
+				}
+				if downloaded {
+					fmt.Printf("fetched %s for %s\n", recipeAndVersion, platform)
+				} else {
+					fmt.Printf("%s for %s is already cached\n", recipeAndVersion, platform)
+				}
+			}
+		}
+		if failed > 0 {
+			fmt.Printf("%d package(s) failed to fetch\n", failed)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fetchCmd)
+	fetchCmd.Flags().StringSlice("platform", nil, "<os>/<arch> to fetch packages for, can be repeated (defaults to the current platform)")
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/vishen/pacm/archive"
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <recipe>@<version>",
+	Short: "Show what installing a package does with each file in its archive",
+	Long: `Lists every entry in the archive of a package, with its type, size and
+executable format, and whether installing the package for --os and --arch
+would install it and why.
+
+Use --archive to inspect an archive on disk against a recipe, in which case
+the version is optional.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		archivePath, _ := cmd.Flags().GetString("archive")
+		if len(args) != 1 {
+			fmt.Printf("need a <recipe>@<version> to inspect\n")
+			return
+		}
+		recipeName, version := args[0], ""
+		if i := strings.Index(args[0], "@"); i >= 0 {
+			recipeName, version = args[0][:i], args[0][i+1:]
+		}
+		if version == "" && archivePath == "" {
+			fmt.Printf("%q needs to be in format <recipe>@<version>, or use --archive\n", args[0])
+			return
+		}
+		conf, err := getConfig(cmd)
+		if err != nil {
+			fmt.Printf("unable to load config: %v\n", err)
+			return
+		}
+		arch, OS := getPlatform(cmd)
+		entries, err := conf.Inspect(rootCtx, arch, OS, recipeName, version, archivePath)
+		if err != nil && len(entries) == 0 {
+			fmt.Printf("unable to inspect %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+
+		nested := false
+		for _, ie := range entries {
+			nested = nested || ie.Archive != ""
+		}
+		header := []string{"Entry", "Type", "Size", "Format", "Installed", "Reason"}
+		if nested {
+			header = append([]string{"Archive"}, header...)
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(header)
+		table.SetAutoWrapText(false)
+		installed := 0
+		for _, ie := range entries {
+			e := ie.Entry
+			name := e.Name
+			if e.Decompressed {
+				name = "(decompressed)"
+			}
+			if e.Linkname != "" {
+				name += " -> " + e.Linkname
+			}
+			size := ""
+			if e.Size >= 0 && e.Type == archive.TypeFile {
+				size = strconv.FormatInt(e.Size, 10)
+			}
+			d := []string{name, e.Type.String(), size, ie.Format, "", ie.Reason}
+			if ie.Installed {
+				installed++
+				d[4] = "yes"
+			}
+			if nested {
+				d = append([]string{ie.Archive}, d...)
+			}
+			table.Append(d)
+		}
+		table.Render() // Send output
+		if err != nil {
+			fmt.Printf("installing %s for %s/%s would fail: %v\n", args[0], OS, arch, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d of %d entries would be installed for %s/%s\n", installed, len(entries), OS, arch)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+	inspectCmd.Flags().String("archive", "", "path to an archive to inspect instead of downloading the package")
+}
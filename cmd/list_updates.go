@@ -6,7 +6,7 @@ import (
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
-	"github.com/vishen/pacm/releases"
+	"github.com/vishen/pacm/version"
 )
 
 // listUpdatesCmd represents the listUpdates command
@@ -19,10 +19,13 @@ var listUpdatesCmd = &cobra.Command{
 			fmt.Printf("unable to load config: %v\n", err)
 			return
 		}
+		client := conf.ReleasesClient()
 		showAll := len(args) == 0
 		foundRecipe := false
 		for _, r := range conf.Recipes {
-			if r.ReleasesGithub == "" {
+			// Release sources are validated when loading the config.
+			source, _ := r.ReleaseSource(client)
+			if source == nil {
 				continue
 			}
 			if !showAll {
@@ -39,9 +42,9 @@ var listUpdatesCmd = &cobra.Command{
 			}
 			foundRecipe = true
 
-			grs, err := releases.GithubReleases(r.ReleasesGithub)
+			grs, err := source.Releases(rootCtx)
 			if err != nil {
-				fmt.Printf("%q: unable to get github-release for %q: %v\n", r.Name, r.ReleasesGithub, err)
+				fmt.Printf("%q: unable to get releases from %s: %v\n", r.Name, source, err)
 				continue
 			}
 
@@ -53,7 +56,7 @@ var listUpdatesCmd = &cobra.Command{
 				d[0] = fmt.Sprintf("%s@%s", r.Name, g.TagName)
 				for _, p := range conf.Packages {
 					if p.RecipeName == r.Name {
-						if g.TagName == p.Version || g.TagName == "v"+p.Version {
+						if version.Equal(g.TagName, p.Version) {
 							if p.Active {
 								d[1] = "active,"
 							}
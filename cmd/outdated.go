@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/vishen/pacm/config"
+)
+
+// outdatedCmd represents the outdated command
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated <recipe1> <recipe2>",
+	Short: "Summary of installed recipes with newer releases",
+	Run: func(cmd *cobra.Command, args []string) {
+		conf, err := getConfig(cmd)
+		if err != nil {
+			fmt.Printf("unable to load config: %v\n", err)
+			os.Exit(2)
+		}
+		opts := config.OutdatedOptions{}
+		opts.Prereleases, _ = cmd.Flags().GetBool("prereleases")
+		opts.Drafts, _ = cmd.Flags().GetBool("drafts")
+
+		names := args
+		if len(names) == 0 {
+			seen := map[string]bool{}
+			for _, p := range conf.Packages {
+				if !seen[p.RecipeName] {
+					seen[p.RecipeName] = true
+					names = append(names, p.RecipeName)
+				}
+			}
+			sort.Strings(names)
+		}
+
+		header := []string{"Recipe", "Active", "Installed", "Stable"}
+		if opts.Prereleases {
+			header = append(header, "Prerelease")
+		}
+		header = append(header, "Outdated")
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(header)
+		outdated := 0
+		for _, s := range conf.RecipeStatuses(rootCtx, names, opts) {
+			if s.Err != nil {
+				fmt.Printf("%q: %v\n", s.Recipe, s.Err)
+			}
+			d := []string{s.Recipe, s.Active, s.NewestInstalled, s.NewestStable}
+			if opts.Prereleases {
+				d = append(d, s.NewestPrerelease)
+			}
+			if s.Outdated {
+				outdated++
+				d = append(d, "yes")
+			} else {
+				d = append(d, "")
+			}
+			table.Append(d)
+		}
+		table.Render() // Send output
+
+		// Exit with 1 when there are newer releases so that this can be
+		// used in scripts.
+		if outdated > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(outdatedCmd)
+	outdatedCmd.Flags().Bool("prereleases", false, "include prereleases when looking for newer releases")
+	outdatedCmd.Flags().Bool("drafts", false, "include draft releases when looking for newer releases")
+}
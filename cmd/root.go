@@ -1,23 +1,59 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/vishen/pacm/httpclient"
 )
 
 var cfgFile string
 
+// Version of pacm, set from main.
+var Version = "dev"
+
+// rootCtx is cancelled when pacm is interrupted, anything long running
+// should stop and clean up after itself.
+var rootCtx = context.Background()
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "pacm",
 	Short: "Simple package manager for binaries",
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		// The command is done with the config, cache and install
+		// directory, don't hold them while checking for updates.
+		if loadedConfig != nil {
+			loadedConfig.Unlock()
+		}
+		notifyUpdates(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rootCtx = ctx
+
+	rootCmd.Version = Version
+	httpclient.UserAgent = "pacm/" + Version
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Println("interrupted, cleaning up (interrupt again to force quit)")
+		cancel()
+		<-sigs
+		os.Exit(1)
+	}()
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -29,4 +65,9 @@ func init() {
 	rootCmd.PersistentFlags().BoolP("log-commands", "x", false, "log commands being run")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose debug logging")
 	rootCmd.PersistentFlags().BoolP("download-remotes", "d", false, "download remote package repositories")
+	rootCmd.PersistentFlags().String("dir", "", "directory to install packages to (overrides 'dir' in the config)")
+	rootCmd.PersistentFlags().String("os", "", "os to install packages for (defaults to the current os)")
+	rootCmd.PersistentFlags().String("arch", "", "arch to install packages for (defaults to the current arch)")
+	rootCmd.PersistentFlags().Duration("wait", 0, "how long to wait for another running pacm to finish (ie: 30s)")
+	rootCmd.PersistentFlags().Bool("offline", false, "never access the network, only use what is already cached")
 }
@@ -9,16 +9,17 @@ import (
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
-	"github.com/vishen/pacm/utils"
+	"github.com/vishen/pacm/version"
 )
 
 type status struct {
-	recipe  string
-	version string
-	active  bool
-	modtime time.Time
-	path    string
-	err     string
+	recipe     string
+	version    string
+	constraint string
+	active     bool
+	modtime    time.Time
+	path       string
+	err        string
 }
 
 // statusCmd represents the status command
@@ -42,7 +43,7 @@ var statusCmd = &cobra.Command{
 			if spi.RecipeName != spj.RecipeName {
 				return spi.RecipeName < spj.RecipeName
 			}
-			return utils.SemvarIsBigger(spi.Version, spj.Version)
+			return version.IsNewer(spi.Version, spj.Version)
 		})
 
 		packageStatus := make([]status, len(sortedPackages))
@@ -61,8 +62,9 @@ var statusCmd = &cobra.Command{
 				}
 			}
 			s := status{
-				recipe:  p.RecipeName,
-				version: p.Version,
+				recipe:     p.RecipeName,
+				version:    p.Version,
+				constraint: p.Constraint,
 			}
 			if p.Active {
 				s.active = true
@@ -103,6 +105,12 @@ var statusCmd = &cobra.Command{
 			d := make([]string, headerLength)
 			d[0] = s.recipe
 			d[1] = s.version
+			if s.constraint != "" {
+				if s.version == "" {
+					d[1] = "unresolved"
+				}
+				d[1] += fmt.Sprintf(" (%s)", s.constraint)
+			}
 			if s.active {
 				d[2] = fmt.Sprintf("%s@%s", s.recipe, s.version)
 			}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// upgradeCmd represents the upgrade command
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade <recipe1> <recipe2>",
+	Short: "Upgrade recipes to their newest release",
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		if len(args) == 0 && !all {
+			fmt.Printf("need <recipe>'s to upgrade, or --all\n")
+			return
+		}
+		conf, err := getLockedConfig(cmd)
+		if err != nil {
+			fmt.Printf("unable to load config: %v\n", err)
+			return
+		}
+		keep := conf.Keep
+		if cmd.Flags().Changed("keep") {
+			keep, _ = cmd.Flags().GetInt("keep")
+		}
+
+		recipes := args
+		if all {
+			seen := map[string]bool{}
+			for _, p := range conf.Packages {
+				if !seen[p.RecipeName] {
+					seen[p.RecipeName] = true
+					recipes = append(recipes, p.RecipeName)
+				}
+			}
+			sort.Strings(recipes)
+		}
+
+		arch, OS := getPlatform(cmd)
+		for _, recipe := range recipes {
+			u, err := conf.UpgradeRecipe(rootCtx, arch, OS, recipe, keep)
+			if err != nil {
+				fmt.Printf("unable to upgrade %q: %v\n", recipe, err)
+				if rootCtx.Err() != nil {
+					return
+				}
+				continue
+			}
+			if u.To == "" {
+				fmt.Printf("%s is up-to-date (%s)\n", recipe, u.From)
+				continue
+			}
+			if u.From == "" {
+				fmt.Printf("%s: installing %s\n", recipe, u.To)
+			} else {
+				fmt.Printf("%s: %s -> %s\n", recipe, u.From, u.To)
+			}
+			for _, p := range u.Removed {
+				fmt.Printf("%s: removed %s\n", recipe, p)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+	upgradeCmd.Flags().Bool("all", false, "upgrade every recipe that has an installed package")
+	upgradeCmd.Flags().Int("keep", 0, "how many versions of a recipe to keep installed, 0 keeps every version (overrides 'keep' in the config)")
+}
@@ -2,22 +2,70 @@ package cmd
 
 import (
 	"fmt"
+	"runtime"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/vishen/pacm/config"
 	"github.com/vishen/pacm/logging"
+	"github.com/vishen/pacm/utils"
+	"github.com/vishen/pacm/version"
 )
 
+// loadedConfig is the config loaded by the command being run, if any.
+var loadedConfig *config.Config
+
+// getConfig loads the config for commands that only read from it, the
+// cache and the install directory.
 func getConfig(cmd *cobra.Command) (*config.Config, error) {
+	return loadConfig(cmd, false)
+}
+
+// getLockedConfig loads the config for commands that modify it, the cache
+// or the install directory, locking them against other pacm processes.
+func getLockedConfig(cmd *cobra.Command) (*config.Config, error) {
+	return loadConfig(cmd, true)
+}
+
+func loadConfig(cmd *cobra.Command, lock bool) (*config.Config, error) {
 	activateLogLevel(cmd)
 	configPath, _ := cmd.Flags().GetString("config")
 	downloadRemotes, _ := cmd.Flags().GetBool("download-remotes")
-	if downloadRemotes {
-		return config.Load(configPath)
-	} else {
-		return config.LoadWithoutDownload(configPath)
+	offline, _ := cmd.Flags().GetBool("offline")
+	dir, _ := cmd.Flags().GetString("dir")
+	wait, _ := cmd.Flags().GetDuration("wait")
+	if cmd.Flags().Changed("os") || cmd.Flags().Changed("arch") {
+		arch, OS := getPlatform(cmd)
+		if !utils.IsValidOSArchPair(OS + "_" + arch) {
+			return nil, fmt.Errorf("unsupported platform %s/%s", OS, arch)
+		}
+	}
+	conf, err := config.LoadWithOptions(rootCtx, configPath, config.LoadOptions{
+		DownloadRemotes: downloadRemotes,
+		Offline:         offline,
+		OutputDir:       dir,
+		Lock:            lock,
+		LockWait:        wait,
+	})
+	if err != nil {
+		return nil, err
 	}
+	loadedConfig = conf
+	return conf, nil
+}
+
+// getPlatform returns the arch and os to install packages for,
+// defaulting to the platform pacm is running on.
+func getPlatform(cmd *cobra.Command) (string, string) {
+	arch, _ := cmd.Flags().GetString("arch")
+	OS, _ := cmd.Flags().GetString("os")
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	if OS == "" {
+		OS = runtime.GOOS
+	}
+	return arch, OS
 }
 
 func activateLogLevel(cmd *cobra.Command) {
@@ -25,6 +73,14 @@ func activateLogLevel(cmd *cobra.Command) {
 	logging.Debug, _ = cmd.Flags().GetBool("verbose")
 }
 
+func splitRecipeAndVersion(recipeAndVersion string) (string, string, error) {
+	s := strings.Split(recipeAndVersion, "@")
+	if len(s) != 2 {
+		return "", "", fmt.Errorf("%q needs to be in format <recipe>@<version>", recipeAndVersion)
+	}
+	return s[0], s[1], nil
+}
+
 func extractAndCheckRecipeAndVersion(conf *config.Config, recipeAndVersion string) (*config.Package, error) {
 	s := strings.Split(recipeAndVersion, "@")
 	if len(s) != 2 {
@@ -32,7 +88,10 @@ func extractAndCheckRecipeAndVersion(conf *config.Config, recipeAndVersion strin
 	}
 	var pkg *config.Package
 	for _, p := range conf.Packages {
-		if p.RecipeName == s[0] && p.Version == s[1] {
+		if p.RecipeName != s[0] {
+			continue
+		}
+		if p.Constraint == s[1] || (p.Constraint == "" && version.Equal(p.Version, s[1])) {
 			pkg = p
 			break
 		}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// versionsCmd represents the versions command
+var versionsCmd = &cobra.Command{
+	Use:   "versions <recipe>",
+	Short: "Known versions of a recipe",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Printf("need a <recipe> to list versions for\n")
+			return
+		}
+		conf, err := getConfig(cmd)
+		if err != nil {
+			fmt.Printf("unable to load config: %v\n", err)
+			return
+		}
+		r, ok := conf.FindRecipe(args[0])
+		if !ok {
+			fmt.Printf("unknown recipe %q\n", args[0])
+			return
+		}
+
+		versions, err := conf.RecipeVersions(rootCtx, r)
+		if err != nil {
+			fmt.Printf("%q: unable to get remote versions: %v\n", r.Name, err)
+		}
+		if len(versions) == 0 {
+			fmt.Printf("No versions found for %q\n", r.Name)
+			return
+		}
+
+		arch, OS := getPlatform(cmd)
+		vs := make([]string, len(versions))
+		for i, v := range versions {
+			vs[i] = v.Version
+		}
+		available := conf.AssetsAvailable(rootCtx, arch, OS, r, vs)
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Version", "Status", "Source", fmt.Sprintf("Asset %s/%s", OS, arch)})
+		for _, v := range versions {
+			d := make([]string, 4)
+			d[0] = fmt.Sprintf("%s@%s", r.Name, v.Version)
+			if v.Active {
+				d[1] = "active,"
+			}
+			if v.Installed {
+				d[1] += "installed"
+			}
+			d[2] = strings.Join(v.Sources, ",")
+			if ok, checked := available[v.Version]; !checked {
+				d[3] = "unknown"
+			} else if ok {
+				d[3] = "available"
+			} else {
+				d[3] = "missing"
+			}
+			table.Append(d)
+		}
+		table.Render() // Send output
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionsCmd)
+}
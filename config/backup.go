@@ -0,0 +1,179 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vishen/pacm/logging"
+)
+
+// installBackup keeps a copy of parts of the install tree while packages
+// are being written, so that the tree can be put back the way it was if
+// the install is cancelled half way through.
+type installBackup struct {
+	outputDir string
+
+	// Paths that have been moved out of the way, mapped to where they
+	// were moved to.
+	moved map[string]string
+
+	// Symlinks in the output directory that point into the install
+	// tree, mapped to what they point at.
+	symlinks map[string]string
+}
+
+func (c *Config) backupInstallTree(paths ...string) (*installBackup, error) {
+	b := &installBackup{
+		outputDir: c.OutputDir,
+		moved:     map[string]string{},
+		symlinks:  map[string]string{},
+	}
+	links, err := pacmSymlinks(c.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	b.symlinks = links
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err != nil {
+			// Nothing to back up, but still remove anything that gets
+			// written here if we restore.
+			b.moved[path] = ""
+			continue
+		}
+		backupPath := filepath.Join(filepath.Dir(path), ".backup"+filepath.Base(path))
+		logging.PrintCommand("removeall %s", backupPath)
+		os.RemoveAll(backupPath)
+		logging.PrintCommand("rename %s -> %s", path, backupPath)
+		if err := os.Rename(path, backupPath); err != nil {
+			b.restore()
+			return nil, err
+		}
+		b.moved[path] = backupPath
+	}
+	return b, nil
+}
+
+// restore puts the backed up paths and symlinks back in place, throwing
+// away anything that was written since the backup was taken.
+func (b *installBackup) restore() error {
+	for path, backupPath := range b.moved {
+		logging.PrintCommand("removeall %s", path)
+		os.RemoveAll(path)
+		if backupPath == "" {
+			continue
+		}
+		logging.PrintCommand("rename %s -> %s", backupPath, path)
+		if err := os.Rename(backupPath, path); err != nil {
+			return err
+		}
+	}
+	links, err := pacmSymlinks(b.outputDir)
+	if err != nil {
+		return err
+	}
+	for link := range links {
+		logging.PrintCommand("remove %s", link)
+		os.Remove(link)
+	}
+	for link, target := range b.symlinks {
+		logging.PrintCommand("symlink %s -> %s", target, link)
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreDir puts back a single directory inside of one of the backed up
+// paths, ie: a package directory when the whole install tree was backed
+// up, along with the symlinks that pointed into it.
+func (b *installBackup) restoreDir(dir string) error {
+	links, err := pacmSymlinks(b.outputDir)
+	if err != nil {
+		return err
+	}
+	for link, target := range links {
+		if linksInto(link, target, dir) {
+			logging.PrintCommand("remove %s", link)
+			os.Remove(link)
+		}
+	}
+	logging.PrintCommand("removeall %s", dir)
+	os.RemoveAll(dir)
+	for path, backupPath := range b.moved {
+		if backupPath == "" {
+			continue
+		}
+		rel, err := filepath.Rel(path, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		backupDir := filepath.Join(backupPath, rel)
+		if _, err := os.Lstat(backupDir); err != nil {
+			continue
+		}
+		logging.PrintCommand("rename %s -> %s", backupDir, dir)
+		if err := os.Rename(backupDir, dir); err != nil {
+			return err
+		}
+	}
+	for link, target := range b.symlinks {
+		if !linksInto(link, target, dir) {
+			continue
+		}
+		logging.PrintCommand("symlink %s -> %s", target, link)
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linksInto reports whether the symlink at link points inside of dir.
+func linksInto(link, target, dir string) bool {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(link), target)
+	}
+	target, _ = filepath.Abs(target)
+	return strings.HasPrefix(target, dir+string(filepath.Separator))
+}
+
+// discard removes the backup once it is no longer needed.
+func (b *installBackup) discard() {
+	for _, backupPath := range b.moved {
+		if backupPath == "" {
+			continue
+		}
+		logging.PrintCommand("removeall %s", backupPath)
+		os.RemoveAll(backupPath)
+	}
+}
+
+// pacmSymlinks returns the symlinks in dir that point into the _pacm
+// install tree.
+func pacmSymlinks(dir string) (map[string]string, error) {
+	links := map[string]string{}
+	logging.PrintCommand("readdir %s", dir)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return links, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Mode()&os.ModeSymlink != os.ModeSymlink {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(target, "_pacm") {
+			links[path] = target
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	pacmcache "github.com/vishen/pacm/cache"
+)
+
+// installTree returns every path in dir mapped to its contents, or where
+// it links to for symlinks.
+func installTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			tree[rel] = "-> " + target
+		case fi.IsDir():
+			tree[rel] = "dir"
+		default:
+			tree[rel] = readFile(t, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestCreatePackagesRestore(t *testing.T) {
+	var err error
+	if cache, err = pacmcache.LoadCache(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	r := Recipe{Name: "tool", Layout: LayoutTree}
+	p := &Package{RecipeName: "tool", Version: "1.0.0", Active: true}
+	c := &Config{
+		OutputDir:         t.TempDir(),
+		Recipes:           []Recipe{r},
+		Packages:          []*Package{p},
+		MaxExtractSize:    DefaultMaxExtractSize,
+		MaxExtractEntries: DefaultMaxExtractEntries,
+	}
+	archivePath := c.generateArchivePath("amd64", "linux", r, p.Version)
+	ctx := context.Background()
+
+	installed := tarGz(t,
+		testEntry{Name: "bin/tool", Body: "tool\n", Mode: 0755},
+		testEntry{Name: "lib/tool.so", Body: "lib\n"},
+	)
+	if err := cache.WriteArchive(archivePath, installed); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreatePackages(ctx, "amd64", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	want := installTree(t, c.OutputDir)
+	if want["tool"] == "" {
+		t.Fatalf("tool wasn't linked into the output directory: %v", want)
+	}
+
+	// An archive that fails to install after overwriting the installed
+	// files.
+	failing := tarGz(t,
+		testEntry{Name: "bin/tool", Body: "new tool\n", Mode: 0755},
+		testEntry{Name: "lib/new.so", Body: "new lib\n"},
+		testEntry{Name: "lib/escape", Linkname: "../../../../escape"},
+	)
+	if err := cache.WriteArchive(archivePath, failing); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreatePackages(ctx, "amd64", "linux"); err == nil {
+		t.Errorf("CreatePackages: installed an archive with an escaping symlink")
+	}
+	if got := installTree(t, c.OutputDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("CreatePackages: got %v after a failed install, want %v", got, want)
+	}
+	if err := c.CreatePackagesForRecipe(ctx, "tool", "amd64", "linux"); err == nil {
+		t.Errorf("CreatePackagesForRecipe: installed an archive with an escaping symlink")
+	}
+	if got := installTree(t, c.OutputDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("CreatePackagesForRecipe: got %v after a failed install, want %v", got, want)
+	}
+
+	// Cancelled before anything is installed.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.CreatePackages(cancelled, "amd64", "linux"); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if got := installTree(t, c.OutputDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v after a cancelled install, want %v", got, want)
+	}
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+
+	pacmcache "github.com/vishen/pacm/cache"
+	"github.com/vishen/pacm/logging"
+	"github.com/vishen/pacm/utils"
+)
+
+// Layout of a bundle:
+//
+//	config                     the config file
+//	remote_recipes/<remote>/.. recipe files used by the config
+//	cache/<archive>            cached archives for each platform
+const (
+	bundleConfig        = "config"
+	bundleRemoteRecipes = "remote_recipes/"
+	bundleCache         = "cache/"
+)
+
+// ExportBundle writes a tar to w that contains everything needed to
+// install the packages in the config without network access. platforms
+// are in the form <os>/<arch>.
+func (c *Config) ExportBundle(ctx context.Context, w io.Writer, platforms []string) error {
+	tw := tar.NewWriter(w)
+
+	configData, err := ioutil.ReadFile(c.filename)
+	if err != nil {
+		return err
+	}
+	if err := writeBundleFile(tw, bundleConfig, configData); err != nil {
+		return err
+	}
+
+	remoteDir, err := c.remoteRecipesDir()
+	if err != nil {
+		return err
+	}
+	written := map[string]bool{}
+	for _, p := range c.Packages {
+		r := c.RecipeForPackage(p)
+		if r.source == "" || written[r.source] {
+			continue
+		}
+		written[r.source] = true
+		rel, err := filepath.Rel(remoteDir, r.source)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(r.source)
+		if err != nil {
+			return err
+		}
+		if err := writeBundleFile(tw, bundleRemoteRecipes+filepath.ToSlash(rel), b); err != nil {
+			return err
+		}
+	}
+
+	for _, platform := range platforms {
+		OS, arch, err := utils.ParsePlatform(platform)
+		if err != nil {
+			return err
+		}
+		for _, p := range c.Packages {
+			if p.Version == "" {
+				return fmt.Errorf("%s hasn't been resolved to a version, run 'pacm update %s'", p, p.RecipeName)
+			}
+			r := c.RecipeForPackage(p)
+			b, err := c.getCachedOrDownload(ctx, arch, OS, r, p.Version)
+			if err != nil {
+				return errors.Wrapf(err, "unable to bundle %s@%s for %s", p.RecipeName, p.Version, platform)
+			}
+			archivePath := c.generateArchivePath(arch, OS, r, p.Version)
+			if err := writeBundleFile(tw, bundleCache+archivePath, b); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func writeBundleFile(tw *tar.Writer, name string, data []byte) error {
+	logging.PrintCommand("bundle add %s", name)
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// ImportBundle reads a bundle created by ExportBundle and seeds the cache
+// and remote recipes for the config at configPath. The bundled config is
+// only written to configPath if there isn't a config there already.
+// lockWait is how long to wait for another pacm process using the cache.
+func ImportBundle(configPath string, r io.Reader, lockWait time.Duration) error {
+	if configPath == "" {
+		configPath = DefaultConfigPath
+	}
+	var (
+		c         *Config
+		remoteDir string
+		archives  *pacmcache.Cache
+	)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return fmt.Errorf("invalid path %q in bundle", hdr.Name)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+
+		if name == bundleConfig {
+			if err := importBundleConfig(configPath, b); err != nil {
+				return err
+			}
+			continue
+		}
+		// The config is always the first file in a bundle, the rest of
+		// the files are written relative to its cache directory.
+		if c == nil {
+			if c, err = loadGlobals(configPath); err != nil {
+				return err
+			}
+			if remoteDir, err = c.remoteRecipesDir(); err != nil {
+				return err
+			}
+			cacheDir, err := pacmcache.Dir(c.CacheDir)
+			if err != nil {
+				return err
+			}
+			l, err := lockCache(cacheDir, lockWait)
+			if err != nil {
+				return err
+			}
+			defer l.Release()
+			if archives, err = pacmcache.LoadCache(c.CacheDir); err != nil {
+				return err
+			}
+		}
+		switch {
+		case strings.HasPrefix(name, bundleRemoteRecipes):
+			outPath := filepath.Join(remoteDir, filepath.FromSlash(strings.TrimPrefix(name, bundleRemoteRecipes)))
+			logging.PrintCommand("mkdirall %s 0755", filepath.Dir(outPath))
+			if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+				return err
+			}
+			logging.PrintCommand("writefile %s 0644", outPath)
+			if err := ioutil.WriteFile(outPath, b, 0644); err != nil {
+				return err
+			}
+		case strings.HasPrefix(name, bundleCache):
+			archive := strings.TrimPrefix(name, bundleCache)
+			if strings.Contains(archive, "/") {
+				return fmt.Errorf("invalid cache path %q in bundle", hdr.Name)
+			}
+			if err := archives.WriteArchive(archive, b); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected file %q in bundle", hdr.Name)
+		}
+	}
+	return nil
+}
+
+func importBundleConfig(path string, data []byte) error {
+	configPath, err := homedir.Expand(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		logging.DebugLog("%s already exists, not overwriting with bundled config\n", configPath)
+		return nil
+	}
+	logging.PrintCommand("mkdirall %s 0755", filepath.Dir(configPath))
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return err
+	}
+	logging.PrintCommand("writefile %s 0644", configPath)
+	return ioutil.WriteFile(configPath, data, 0644)
+}
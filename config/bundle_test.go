@@ -0,0 +1,85 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// setHome points the default config and cache paths at a new directory.
+func setHome(t *testing.T) string {
+	t.Helper()
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return home
+}
+
+func TestBundleOffline(t *testing.T) {
+	ctx := context.Background()
+
+	// A config that only uses local recipes, with its archive cached.
+	home := setHome(t)
+	configData := `[recipe tool]
+url=https://example.invalid/tool-{{.Version}}
+binary=true
+binary_name=tool
+[tool@1.0.0]
+active=true
+`
+	configPath := filepath.Join(home, ".config", "pacm", "config")
+	cacheDir := filepath.Join(home, ".config", "pacm", "cache")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cacheDir, "tool_1.0.0_amd64-linux"), []byte("tool\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadWithOptions(ctx, "", LoadOptions{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle bytes.Buffer
+	if err := c.ExportBundle(ctx, &bundle, []string{"linux/amd64"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Import it somewhere that pacm has never run, and install offline.
+	setHome(t)
+	if err := ImportBundle("", &bundle, 0); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	c, err = LoadWithOptions(ctx, "", LoadOptions{Offline: true, OutputDir: outputDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreatePackages(ctx, "amd64", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(outputDir, "tool")); got != "tool\n" {
+		t.Errorf("tool = %q, want %q", got, "tool\n")
+	}
+}
+
+func TestOfflineMissingRecipe(t *testing.T) {
+	home := setHome(t)
+	configPath := filepath.Join(home, "config")
+	if err := ioutil.WriteFile(configPath, []byte("[terraform@0.12.0]\nactive=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadWithOptions(context.Background(), configPath, LoadOptions{Offline: true})
+	want := `recipe with name "terraform" does not exist, remote recipes github.com/vishen/pacm-recipes aren't in the cache (offline mode)`
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
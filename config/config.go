@@ -1,35 +1,41 @@
 package config
 
 import (
-	"archive/tar"
-	"archive/zip"
 	"bytes"
-	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/h2non/filetype"
 	getter "github.com/hashicorp/go-getter"
 	"github.com/knq/ini"
 	"github.com/knq/ini/parser"
 	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
-	"github.com/xi2/xz"
 
+	"github.com/vishen/pacm/archive"
 	pacmcache "github.com/vishen/pacm/cache"
+	"github.com/vishen/pacm/httpclient"
+	"github.com/vishen/pacm/lock"
 	"github.com/vishen/pacm/logging"
+	"github.com/vishen/pacm/releases"
 	"github.com/vishen/pacm/utils"
+	pacmversion "github.com/vishen/pacm/version"
 )
 
 const (
 	DefaultConfigPath = "~/.config/pacm/config"
+
+	// How long cached release information is used before checking
+	// for new releases.
+	releasesMaxAge = 10 * time.Minute
 )
 
 var cache *pacmcache.Cache
@@ -51,26 +57,191 @@ type Config struct {
 	OutputDir string
 	CacheDir  string
 
+	HTTP httpclient.Options
+
 	Recipes  []Recipe
 	Packages []*Package
 
 	CurrentlyInstalled []Installed
+
+	// Offline stops pacm from touching the network, anything that
+	// isn't already in the cache will fail to load.
+	Offline bool
+
+	// Keep is how many versions of a recipe `pacm upgrade` leaves
+	// installed, 0 keeps every version.
+	Keep int
+
+	// CheckUpdates is how often to check for newer releases in the
+	// background, 0 never checks.
+	CheckUpdates time.Duration
+
+	// MaxExtractSize and MaxExtractEntries limit the uncompressed size
+	// and number of entries of a package's archive, 0 is unlimited.
+	MaxExtractSize    int64
+	MaxExtractEntries int
+
+	locks    []*lock.Lock
+	lockWait time.Duration
+
+	// uncachedRemotes are the remote recipes that were skipped because
+	// they weren't in the cache while offline.
+	uncachedRemotes []string
+}
+
+// LoadOptions control how a config file, and the resources it
+// references, are loaded.
+type LoadOptions struct {
+	// DownloadRemotes forces the remote recipes to be downloaded
+	// again, even if they already exist on disk.
+	DownloadRemotes bool
+
+	// Offline disables all network access.
+	Offline bool
+
+	// CachedRemotes only uses the remote recipes already in the cache,
+	// and never downloads or creates them, so that the cache isn't
+	// written to without holding its lock.
+	CachedRemotes bool
+
+	// OutputDir overrides the 'dir' set in the config file.
+	OutputDir string
+
+	// Lock takes advisory locks on the config file, cache and output
+	// directory so that other pacm processes can't modify them. The
+	// locks are held until Unlock is called or the process exits.
+	Lock bool
+	// LockWait is how long to wait for another pacm process to release
+	// its locks before giving up.
+	LockWait time.Duration
 }
 
 func Load(path string) (*Config, error) {
-	return load(path, true)
+	return LoadWithOptions(context.Background(), path, LoadOptions{DownloadRemotes: true})
 }
 
 func LoadWithoutDownload(path string) (*Config, error) {
-	return load(path, false)
+	return LoadWithOptions(context.Background(), path, LoadOptions{})
+}
+
+func LoadWithOptions(ctx context.Context, path string, opts LoadOptions) (config *Config, err error) {
+	if opts.Offline && opts.DownloadRemotes {
+		return nil, fmt.Errorf("unable to download remote recipes while offline")
+	}
+
+	var locks []*lock.Lock
+	defer func() {
+		if err != nil {
+			releaseLocks(locks)
+		}
+	}()
+
+	// The config lock needs to be taken before reading the config file,
+	// otherwise we might be reading a config that is about to change.
+	if opts.Lock {
+		l, err := lockConfig(path, opts.LockWait)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+
+	config, err = loadGlobals(path)
+	if err != nil {
+		return nil, err
+	}
+	config.Offline = opts.Offline
+	if err := httpclient.Configure(config.HTTP); err != nil {
+		return nil, errors.Wrap(err, "unable to configure http client")
+	}
+	if opts.OutputDir != "" {
+		config.OutputDir = opts.OutputDir
+	}
+	if opts.Lock {
+		dirLocks, err := config.lockDirs(opts.LockWait)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, dirLocks...)
+	}
+	if err := config.loadRemoteRecipes(ctx, opts); err != nil {
+		return nil, err
+	}
+	cache, err = pacmcache.LoadCache(config.CacheDir)
+	if err != nil {
+		log.Fatalf("unable to load cache: %v", err)
+	}
+	if err := config.parseIniFile(config.iniFile, "", true); err != nil {
+		return nil, err
+	}
+	if err := config.populateCurrentlyInstalled(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config.locks = locks
+	config.lockWait = opts.LockWait
+	return config, nil
+}
+
+// loadRemoteRecipes loads the remote recipes, downloading them if needed.
+// Without the locks taken by LoadOptions.Lock, the cache is locked while
+// they are downloaded so that another pacm isn't reading them.
+func (c *Config) loadRemoteRecipes(ctx context.Context, opts LoadOptions) error {
+	if opts.CachedRemotes {
+		dir, err := c.remoteRecipesDir()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(dir); err != nil {
+			logging.DebugLog("no remote recipes in %s, skipping\n", dir)
+			return nil
+		}
+		return c.downloadRemoteRecipes(ctx, false)
+	}
+	shouldDownload, err := c.shouldDownloadRemotes(opts.DownloadRemotes)
+	if err != nil {
+		return err
+	}
+	if shouldDownload && !opts.Lock {
+		cacheDir, err := pacmcache.Dir(c.CacheDir)
+		if err != nil {
+			return err
+		}
+		l, err := lockCache(cacheDir, opts.LockWait)
+		if err != nil {
+			return err
+		}
+		defer l.Release()
+	}
+	return c.downloadRemoteRecipes(ctx, shouldDownload)
+}
+
+// shouldDownloadRemotes reports whether the remote recipes need to be
+// downloaded, either because force is set or they haven't been yet.
+func (c *Config) shouldDownloadRemotes(force bool) (bool, error) {
+	dir, err := c.remoteRecipesDir()
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(dir); err != nil && !c.Offline {
+		return true, nil
+	}
+	return force, nil
 }
 
-func load(path string, downloadResources bool) (*Config, error) {
+func expandConfigPath(path string) (string, error) {
 	if path == "" {
 		path = DefaultConfigPath
 	}
+	return homedir.Expand(path)
+}
 
-	configPath, err := homedir.Expand(path)
+// loadGlobals reads the config file at path but only parses the
+// global configuration and the recipes declared in it.
+func loadGlobals(path string) (*Config, error) {
+	configPath, err := expandConfigPath(path)
 	if err != nil {
 		return nil, err
 	}
@@ -90,6 +261,10 @@ func load(path string, downloadResources bool) (*Config, error) {
 		filename: configPath,
 		Recipes:  []Recipe{},
 		Packages: []*Package{},
+
+		HTTP:              httpclient.Options{MaxRedirects: httpclient.DefaultMaxRedirects},
+		MaxExtractSize:    DefaultMaxExtractSize,
+		MaxExtractEntries: DefaultMaxExtractEntries,
 	}
 
 	// Only parse global configurations. This is required to get
@@ -97,29 +272,15 @@ func load(path string, downloadResources bool) (*Config, error) {
 	// the packages so we can parse them later so that they overwrite
 	// anything found in remote recipes.
 	// TODO: THIS IS A LARGE HACK
-	if err := config.parseIniFile(config.iniFile, false); err != nil {
-		return nil, err
-	}
-	if err := config.downloadRemoteRecipes(downloadResources); err != nil {
-		return nil, err
-	}
-	cache, err = pacmcache.LoadCache(config.CacheDir)
-	if err != nil {
-		log.Fatalf("unable to load cache: %v", err)
-	}
-	if err := config.parseIniFile(config.iniFile, true); err != nil {
-		return nil, err
-	}
-	if err := config.populateCurrentlyInstalled(); err != nil {
-		return nil, err
-	}
-	if err := config.Validate(); err != nil {
+	if err := config.parseIniFile(config.iniFile, "", false); err != nil {
 		return nil, err
 	}
 	return config, nil
 }
 
-func (c *Config) parseIniFile(f *ini.File, parsePackages bool) error {
+// parseIniFile parses the sections of an ini file, source is the path
+// of the recipe file being parsed or empty for the config file.
+func (c *Config) parseIniFile(f *ini.File, source string, parsePackages bool) error {
 	for _, s := range f.AllSections() {
 		n := s.Name()
 		switch {
@@ -129,7 +290,16 @@ func (c *Config) parseIniFile(f *ini.File, parsePackages bool) error {
 			}
 			continue
 		case strings.HasPrefix(n, "recipe "):
-			if err := c.handleRecipe(s); err != nil {
+			if err := c.handleRecipe(s, source); err != nil {
+				return err
+			}
+		case strings.HasPrefix(n, "auth "):
+			// Only trust credentials from the users own config, never
+			// from remote recipes.
+			if source != "" {
+				return fmt.Errorf("[%s] is only allowed in the config file, found in %s", n, source)
+			}
+			if err := c.handleAuth(s); err != nil {
 				return err
 			}
 		case strings.HasPrefix(n, "checksum "):
@@ -145,20 +315,22 @@ func (c *Config) parseIniFile(f *ini.File, parsePackages bool) error {
 	return nil
 }
 
-func (c *Config) downloadRemoteRecipes(shouldDownload bool) error {
-	path := filepath.Join(c.CacheDir, "remote_recipes")
-	dir, err := homedir.Expand(path)
+func (c *Config) remoteRecipesDir() (string, error) {
+	return homedir.Expand(filepath.Join(c.CacheDir, "remote_recipes"))
+}
+
+func (c *Config) downloadRemoteRecipes(ctx context.Context, shouldDownload bool) error {
+	dir, err := c.remoteRecipesDir()
 	if err != nil {
 		return err
 	}
 
-	if _, err := os.Stat(dir); err != nil {
-		shouldDownload = true
-	}
-
-	logging.PrintCommand("mkdirall %s 0755", dir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+	// Offline, the cache is only read from.
+	if !c.Offline {
+		logging.PrintCommand("mkdirall %s 0755", dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
 	}
 
 	// TODO: Make configurable and allow multiple remotes
@@ -166,21 +338,41 @@ func (c *Config) downloadRemoteRecipes(shouldDownload bool) error {
 
 	for _, remote := range remotes {
 		remoteFolder := filepath.Join(dir, strings.Replace(remote, "/", "_", -1))
-		if shouldDownload {
+		if c.Offline {
+			// Packages might only use local recipes, so only fail
+			// if a package needs a recipe that wasn't found.
+			if _, err := os.Stat(remoteFolder); err != nil {
+				logging.DebugLog("remote recipes %q not in cache, skipping\n", remote)
+				c.uncachedRemotes = append(c.uncachedRemotes, remote)
+				continue
+			}
+		} else if shouldDownload {
 			logging.PrintCommand("removeall %s", remoteFolder)
 			os.RemoveAll(remoteFolder)
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 			defer cancel()
-			// Build the client
+			// Build the client, making sure any http requests use
+			// the shared pacm http client.
+			getters := map[string]getter.Getter{}
+			for k, v := range getter.Getters {
+				getters[k] = v
+			}
+			httpGetter := &getter.HttpGetter{Netrc: true, Client: httpclient.Client()}
+			getters["http"] = httpGetter
+			getters["https"] = httpGetter
 			client := &getter.Client{
-				Ctx:  ctx,
-				Src:  remote,
-				Dst:  remoteFolder,
-				Pwd:  ".",
-				Mode: getter.ClientModeAny,
+				Ctx:     ctx,
+				Src:     remote,
+				Dst:     remoteFolder,
+				Pwd:     ".",
+				Mode:    getter.ClientModeAny,
+				Getters: getters,
 			}
 			logging.PrintCommand("go-getter %s", remote)
 			if err := client.Get(); err != nil {
+				// Don't leave partially downloaded recipes around.
+				logging.PrintCommand("removeall %s", remoteFolder)
+				os.RemoveAll(remoteFolder)
 				return err
 			}
 		} else {
@@ -230,7 +422,7 @@ func (c *Config) handleRecipeFiles(folder string) error {
 			if err != nil {
 				return err
 			}
-			if err := c.parseIniFile(f, true); err != nil {
+			if err := c.parseIniFile(f, recipePath, true); err != nil {
 				return err
 			}
 		}
@@ -247,6 +439,56 @@ func (c *Config) handleGlobal(section *parser.Section) error {
 			c.OutputDir = v
 		case "cache":
 			c.CacheDir = v
+		case "http_proxy":
+			c.HTTP.HTTPProxy = v
+		case "https_proxy":
+			c.HTTP.HTTPSProxy = v
+		case "no_proxy":
+			c.HTTP.NoProxy = v
+		case "ca_files":
+			c.HTTP.CAFiles = strings.Split(v, ",")
+		case "connect_timeout", "timeout", "check_updates":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("unable to parse duration from [%s = %q]: %v", k, v, err)
+			}
+			switch k {
+			case "timeout":
+				c.HTTP.Timeout = d
+			case "connect_timeout":
+				c.HTTP.ConnectTimeout = d
+			case "check_updates":
+				c.CheckUpdates = d
+			}
+		case "max_redirects":
+			var err error
+			if c.HTTP.MaxRedirects, err = strconv.Atoi(v); err != nil {
+				return fmt.Errorf("unable to parse number from [%s = %q]: %v", k, v, err)
+			}
+			if c.HTTP.MaxRedirects < 0 {
+				return fmt.Errorf("[%s = %q] can't be negative", k, v)
+			}
+		case "keep":
+			var err error
+			if c.Keep, err = strconv.Atoi(v); err != nil {
+				return fmt.Errorf("unable to parse number from [%s = %q]: %v", k, v, err)
+			}
+			if c.Keep < 0 {
+				return fmt.Errorf("[%s = %q] can't be negative", k, v)
+			}
+		case "max_extract_size":
+			var err error
+			if c.MaxExtractSize, err = utils.ParseSize(v); err != nil {
+				return fmt.Errorf("unable to parse size from [%s = %q]: %v", k, v, err)
+			}
+		case "max_extract_entries":
+			var err error
+			if c.MaxExtractEntries, err = strconv.Atoi(v); err != nil {
+				return fmt.Errorf("unable to parse number from [%s = %q]: %v", k, v, err)
+			}
+			if c.MaxExtractEntries < 0 {
+				return fmt.Errorf("[%s = %q] can't be negative", k, v)
+			}
 		default:
 			return fmt.Errorf("unexpected key %q in global section", k)
 		}
@@ -254,10 +496,34 @@ func (c *Config) handleGlobal(section *parser.Section) error {
 	return nil
 }
 
-func (c *Config) handleRecipe(section *parser.Section) error {
+func (c *Config) handleAuth(section *parser.Section) error {
+	host := strings.TrimSpace(strings.Replace(section.Name(), "auth ", "", 1))
+	var creds httpclient.Credentials
+	for _, k := range section.RawKeys() {
+		v := section.GetRaw(k)
+		switch k {
+		case "token":
+			creds.Token = v
+		case "username":
+			creds.Username = v
+		case "password":
+			creds.Password = v
+		default:
+			return fmt.Errorf("unexpected key %q in [auth %s]", k, host)
+		}
+	}
+	if c.HTTP.Auth == nil {
+		c.HTTP.Auth = map[string]httpclient.Credentials{}
+	}
+	c.HTTP.Auth[strings.ToLower(host)] = creds
+	return nil
+}
+
+func (c *Config) handleRecipe(section *parser.Section, source string) error {
 	name := strings.Replace(section.Name(), "recipe ", "", 1)
 	name = strings.TrimSpace(name)
 	r := Recipe{
+		source:          source,
 		Name:            name,
 		AvailableArchOS: map[string]string{},
 	}
@@ -278,8 +544,47 @@ func (c *Config) handleRecipe(section *parser.Section) error {
 			r.ExtractPaths = strings.Split(v, ",")
 		case "releases_github":
 			r.ReleasesGithub = v
+		case "releases_gitlab":
+			r.ReleasesGitlab = v
+		case "releases_gitlab_url":
+			r.ReleasesGitlabURL = v
+		case "releases_gitea":
+			r.ReleasesGitea = v
+		case "releases_gitea_url":
+			r.ReleasesGiteaURL = v
+		case "releases_json":
+			r.ReleasesJSON = v
+		case "releases_json_path":
+			r.ReleasesJSONPath = v
+		case "releases_json_regex":
+			r.ReleasesJSONRegex = v
+		case "releases_index":
+			r.ReleasesIndex = v
+		case "releases_index_regex":
+			r.ReleasesIndexRegex = v
 		case "library_paths":
 			r.LibraryPaths = strings.Split(v, ",")
+		case "inner_archive":
+			r.InnerArchive = v
+		case "layout":
+			if v != LayoutFlat && v != LayoutTree {
+				return fmt.Errorf("invalid value for [recipe %s.%s = %q], expected %q or %q", name, k, v, LayoutFlat, LayoutTree)
+			}
+			r.Layout = v
+		case "strip_components":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid value for [recipe %s.%s = %q], expected a number of directories", name, k, v)
+			}
+			r.StripComponents = n
+		case "bin_paths":
+			r.BinPaths = strings.Split(v, ",")
+		case "versions":
+			for _, version := range strings.Split(v, ",") {
+				if version = strings.TrimSpace(version); version != "" {
+					r.Versions = append(r.Versions, version)
+				}
+			}
 		default:
 			if utils.IsValidOSArchPair(k) {
 				r.AvailableArchOS[k] = v
@@ -314,6 +619,13 @@ func (c *Config) handlePackage(section *parser.Section) error {
 		RecipeName: nameAndVersion[0],
 		Version:    nameAndVersion[1],
 	}
+	if pacmversion.IsConstraint(p.Version) {
+		if _, err := pacmversion.ParseConstraint(p.Version); err != nil {
+			return fmt.Errorf("[%s]: %v", n, err)
+		}
+		p.Constraint = p.Version
+		p.Version = ""
+	}
 	for _, k := range section.RawKeys() {
 		v := section.GetRaw(k)
 		switch k {
@@ -325,6 +637,11 @@ func (c *Config) handlePackage(section *parser.Section) error {
 			}
 		case "executable":
 			p.ExecutableName = v
+		case "resolved":
+			if p.Constraint == "" {
+				return fmt.Errorf("'resolved' is only allowed for version constraints, found in [%s]", n)
+			}
+			p.Version = v
 		default:
 			return fmt.Errorf("unexpected key %q in [%s]", k, n)
 		}
@@ -333,27 +650,25 @@ func (c *Config) handlePackage(section *parser.Section) error {
 	return nil
 }
 
-func (c *Config) AddPackage(arch, OS, recipeName, version string) error {
+func (c *Config) AddPackage(ctx context.Context, arch, OS, recipeName, version string) error {
+	if pacmversion.IsConstraint(version) {
+		return c.addConstraintPackage(ctx, arch, OS, recipeName, version)
+	}
+
 	// Check if the package is already installed.
 	for _, p := range c.Packages {
-		if p.RecipeName == recipeName && p.Version == version {
-			return fmt.Errorf("%s@%s is already installed", recipeName, version)
+		if p.Constraint == "" && p.RecipeName == recipeName && pacmversion.Equal(p.Version, version) {
+			return fmt.Errorf("%s@%s is already installed", recipeName, p.Version)
 		}
 	}
 
 	// Check to see if the recipe exists.
-	var recipe Recipe
-	for _, r := range c.Recipes {
-		if r.Name == recipeName {
-			recipe = r
-			break
-		}
-	}
-	if recipe.Name == "" {
+	recipe, ok := c.FindRecipe(recipeName)
+	if !ok {
 		return fmt.Errorf("unknown recipe %q", recipeName)
 	}
 
-	if _, err := c.getCachedOrDownload(arch, OS, recipe, version); err != nil {
+	if _, err := c.getCachedOrDownload(ctx, arch, OS, recipe, version); err != nil {
 		return err
 	}
 
@@ -374,7 +689,100 @@ func (c *Config) AddPackage(arch, OS, recipeName, version string) error {
 	return c.MakePackageActive(pkg)
 }
 
+// addConstraintPackage adds a package for a version constraint, or updates
+// the package for the constraint if there is one already, and makes it
+// active.
+func (c *Config) addConstraintPackage(ctx context.Context, arch, OS, recipeName, constraint string) error {
+	if _, err := pacmversion.ParseConstraint(constraint); err != nil {
+		return err
+	}
+	if _, ok := c.FindRecipe(recipeName); !ok {
+		return fmt.Errorf("unknown recipe %q", recipeName)
+	}
+	var pkg *Package
+	for _, p := range c.Packages {
+		if p.RecipeName == recipeName && p.Constraint == constraint {
+			pkg = p
+			break
+		}
+	}
+	if pkg == nil {
+		pkg = &Package{
+			iniSection: c.iniFile.AddSection(fmt.Sprintf("%s@%s", recipeName, constraint)),
+			RecipeName: recipeName,
+			Constraint: constraint,
+		}
+		c.Packages = append(c.Packages, pkg)
+	}
+	if err := c.resolvePackage(ctx, arch, OS, pkg); err != nil {
+		if pkg.Version == "" {
+			c.iniFile.RemoveSection(pkg.iniSection.Name())
+			c.Packages = c.Packages[:len(c.Packages)-1]
+		}
+		return err
+	}
+	return c.MakePackageActive(pkg)
+}
+
+// ResolvePackages resolves every package for a recipe that uses a version
+// constraint to the newest version that satisfies it, and records the
+// resolved versions in the config. Returns the packages that resolved to
+// a different version.
+func (c *Config) ResolvePackages(ctx context.Context, arch, OS, recipeName string) ([]*Package, error) {
+	var (
+		found   bool
+		changed []*Package
+	)
+	for _, p := range c.Packages {
+		if p.RecipeName != recipeName || p.Constraint == "" {
+			continue
+		}
+		found = true
+		previous := p.Version
+		if err := c.resolvePackage(ctx, arch, OS, p); err != nil {
+			return nil, errors.Wrapf(err, "unable to resolve %s", p)
+		}
+		if previous != p.Version {
+			changed = append(changed, p)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no packages with a version constraint for %q", recipeName)
+	}
+	return changed, c.save()
+}
+
+// resolvePackage resolves a package with a version constraint and makes
+// sure the archive for the resolved version is in the cache. The config
+// isn't saved.
+func (c *Config) resolvePackage(ctx context.Context, arch, OS string, p *Package) error {
+	r, ok := c.FindRecipe(p.RecipeName)
+	if !ok {
+		return fmt.Errorf("unknown recipe %q", p.RecipeName)
+	}
+	v, err := c.ResolveConstraint(ctx, r, p.Constraint)
+	if err != nil {
+		return err
+	}
+	if _, err := c.getCachedOrDownload(ctx, arch, OS, r, v); err != nil {
+		return err
+	}
+	if v != p.Version {
+		logging.DebugLog("resolved %s to %s\n", p, v)
+	}
+	p.Version = v
+	p.iniSection.SetKey("resolved", v)
+	return nil
+}
+
 func (c *Config) MakePackageActive(p *Package) error {
+	c.setActive(p)
+	return c.save()
+}
+
+// setActive makes p the active package for its recipe without saving the
+// config.
+func (c *Config) setActive(p *Package) {
 	for _, pkg := range c.Packages {
 		if p.RecipeName == pkg.RecipeName {
 			pkg.Active = false
@@ -383,6 +791,9 @@ func (c *Config) MakePackageActive(p *Package) error {
 	}
 	p.Active = true
 	p.iniSection.SetKey("active", "true")
+}
+
+func (c *Config) save() error {
 	logging.PrintCommand("write to config %s", c.filename)
 	if err := c.iniFile.Write(c.filename); err != nil {
 		return errors.Wrap(err, "unable to save config file")
@@ -390,6 +801,26 @@ func (c *Config) MakePackageActive(p *Package) error {
 	return nil
 }
 
+// ReleasesClient returns a client for looking up releases that caches
+// responses in the cache directory.
+func (c *Config) ReleasesClient() *releases.Client {
+	return &releases.Client{
+		CacheDir: filepath.Join(cache.Path(), ".releases"),
+		MaxAge:   releasesMaxAge,
+		Offline:  c.Offline,
+	}
+}
+
+// FindRecipe returns the recipe with the given name.
+func (c *Config) FindRecipe(name string) (Recipe, bool) {
+	for _, r := range c.Recipes {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Recipe{}, false
+}
+
 func (c *Config) RecipeForPackage(p *Package) Recipe {
 	for _, r := range c.Recipes {
 		if r.Name == p.RecipeName {
@@ -411,6 +842,9 @@ func (c *Config) Validate() error {
 				break
 			}
 		}
+		if !foundRecipe && len(c.uncachedRemotes) > 0 {
+			return fmt.Errorf("recipe with name %q does not exist, remote recipes %s aren't in the cache (offline mode)", p.RecipeName, strings.Join(c.uncachedRemotes, ", "))
+		}
 		if !foundRecipe {
 			return fmt.Errorf("recipe with name %q does not exist", p.RecipeName)
 		}
@@ -419,24 +853,181 @@ func (c *Config) Validate() error {
 		if r.IsBinary && r.BinaryName == "" {
 			return fmt.Errorf("recipe %q is marked binary but missing 'binary_name' field", r.Name)
 		}
+		if r.Layout != LayoutTree && (r.StripComponents > 0 || len(r.BinPaths) > 0) {
+			return fmt.Errorf("recipe %q has 'strip_components' or 'bin_paths' but isn't 'layout=%s'", r.Name, LayoutTree)
+		}
+		for _, bp := range r.BinPaths {
+			if _, err := path.Match(strings.TrimSpace(bp), ""); err != nil {
+				return fmt.Errorf("recipe %q has an invalid 'bin_paths' pattern %q", r.Name, bp)
+			}
+		}
+		if keys := r.releaseSourceKeys(); len(keys) > 1 {
+			return fmt.Errorf("recipe %q has more than one release source, only one of %s is allowed", r.Name, strings.Join(keys, ", "))
+		}
+		if r.ReleasesGitea != "" && r.ReleasesGiteaURL == "" {
+			return fmt.Errorf("recipe %q has 'releases_gitea' but is missing 'releases_gitea_url' field", r.Name)
+		}
+		if r.ReleasesIndex != "" && r.ReleasesIndexRegex == "" {
+			return fmt.Errorf("recipe %q has 'releases_index' but is missing 'releases_index_regex' field", r.Name)
+		}
+		if _, err := r.ReleaseSource(&releases.Client{}); err != nil {
+			return fmt.Errorf("recipe %q has an invalid release source: %v", r.Name, err)
+		}
 	}
 	return nil
 }
 
 func (c *Config) WriteLibrary(p *Package, filename string, isDir bool, mode os.FileMode, data []byte) error {
-	outPath := filepath.Join(c.OutputDir, fmt.Sprintf("_pacm/%s_%s", p.RecipeName, p.Version))
-	outPath, _ = filepath.Abs(outPath)
+	outPath := c.packageDir(p)
 	libraryPath := filepath.Join(outPath, filename)
+	if isDir && libraryPath == outPath {
+		logging.PrintCommand("mkdirall+writingfiles %s 0755", libraryPath)
+		return os.MkdirAll(libraryPath, 0755)
+	}
+	libraryPath, err := c.realPackagePath(p, libraryPath)
+	if err != nil {
+		return err
+	}
 	if isDir {
 		logging.PrintCommand("mkdirall+writingfiles %s 0755", libraryPath)
 		return os.MkdirAll(libraryPath, 0755)
 	}
-	return ioutil.WriteFile(libraryPath, data, mode)
+	// Archives don't always have entries for the directories of their
+	// files.
+	logging.PrintCommand("mkdirall %s 0755", filepath.Dir(libraryPath))
+	if err := os.MkdirAll(filepath.Dir(libraryPath), 0755); err != nil {
+		return err
+	}
+	// Replace, rather than write through, an earlier symlink.
+	if fi, err := os.Lstat(libraryPath); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		logging.PrintCommand("remove %s", libraryPath)
+		if err := os.Remove(libraryPath); err != nil {
+			return err
+		}
+	}
+	logging.PrintCommand("writefile %s %s", libraryPath, mode)
+	if err := ioutil.WriteFile(libraryPath, data, mode); err != nil {
+		return err
+	}
+	// The umask may have removed the executable bits.
+	logging.PrintCommand("chmod %s %s", libraryPath, mode)
+	return os.Chmod(libraryPath, mode)
+}
+
+// writeSymlink creates a symlink at filename in the package directory,
+// refusing targets outside of it.
+func (c *Config) writeSymlink(p *Package, filename, target string) error {
+	realFilename, err := c.realPackagePath(p, filename)
+	if err != nil {
+		return err
+	}
+	dir, err := realPath(c.packageDir(p))
+	if err != nil {
+		return err
+	}
+	// The target is resolved from where the symlink really is, and can't
+	// go back up after going through another link, ie: a/../.. where a
+	// is a link.
+	resolved := filepath.Join(filepath.Dir(realFilename), filepath.FromSlash(target))
+	if path.IsAbs(target) || !upThenDown(target) || !withinDir(dir, resolved) {
+		return fmt.Errorf("symlink %s -> %s points outside of the package", filename, target)
+	}
+	logging.PrintCommand("mkdirall %s 0755", filepath.Dir(realFilename))
+	if err := os.MkdirAll(filepath.Dir(realFilename), 0755); err != nil {
+		return err
+	}
+	logging.PrintCommand("remove %s", realFilename)
+	os.Remove(realFilename)
+	logging.PrintCommand("symlink %s -> %s", target, realFilename)
+	return os.Symlink(target, realFilename)
+}
+
+// writeHardlink creates a hardlink at filename to target, both of which
+// must be in the package directory.
+func (c *Config) writeHardlink(p *Package, filename, target string) error {
+	realFilename, err := c.realPackagePath(p, filename)
+	if err != nil {
+		return err
+	}
+	realTarget, err := c.realPackagePath(p, target)
+	if err != nil {
+		return fmt.Errorf("hardlink %s -> %s points outside of the package", filename, target)
+	}
+	logging.PrintCommand("mkdirall %s 0755", filepath.Dir(realFilename))
+	if err := os.MkdirAll(filepath.Dir(realFilename), 0755); err != nil {
+		return err
+	}
+	logging.PrintCommand("remove %s", realFilename)
+	os.Remove(realFilename)
+	logging.PrintCommand("link %s -> %s", realTarget, realFilename)
+	return os.Link(realTarget, realFilename)
+}
+
+// realPackagePath returns where filename in the package directory really
+// is, once the symlinks in its directories are resolved, failing if that
+// is outside of the package. Entries are written to the returned path so
+// that they are never written through a symlink out of the package.
+func (c *Config) realPackagePath(p *Package, filename string) (string, error) {
+	dir, err := realPath(c.packageDir(p))
+	if err != nil {
+		return "", err
+	}
+	parent, err := realPath(filepath.Dir(filename))
+	if err != nil {
+		return "", err
+	}
+	real := filepath.Join(parent, filepath.Base(filename))
+	if !withinDir(dir, real) {
+		return "", fmt.Errorf("%s is outside of the package", filename)
+	}
+	return real, nil
+}
+
+// realPath resolves the symlinks in the part of filename that exists.
+func realPath(filename string) (string, error) {
+	existing, rest := filename, ""
+	for {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return filename, nil
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// upThenDown reports whether a symlink target only has ".." at its start,
+// so that it doesn't go back up through a directory that is itself a link.
+func upThenDown(target string) bool {
+	down := false
+	for _, part := range strings.Split(target, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if down {
+				return false
+			}
+		default:
+			down = true
+		}
+	}
+	return true
+}
+
+// withinDir reports whether filename is inside of dir.
+func withinDir(dir, filename string) bool {
+	rel, err := filepath.Rel(dir, filename)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 func (c *Config) WritePackage(p *Package, filename string, mode os.FileMode, data []byte) error {
-	outPath := filepath.Join(c.OutputDir, fmt.Sprintf("_pacm/%s_%s", p.RecipeName, p.Version))
-	outPath, _ = filepath.Abs(outPath)
+	outPath := c.packageDir(p)
 	logging.PrintCommand("mkdirall %s 0755", outPath)
 	os.MkdirAll(outPath, 0755)
 
@@ -453,6 +1044,13 @@ func (c *Config) WritePackage(p *Package, filename string, mode os.FileMode, dat
 		return err
 	}
 
+	return c.linkBinary(p, binaryFilepath, filename)
+}
+
+// linkBinary symlinks a binary in the package directory into the output
+// directory as filename_<version>, and as filename if the package is
+// active.
+func (c *Config) linkBinary(p *Package, binaryFilepath, filename string) error {
 	filenameWithVersion := fmt.Sprintf("%s_%s", filename, p.Version)
 	logging.PrintCommand("symlink %s -> %s", binaryFilepath, filenameWithVersion)
 	if err := c.SymlinkFile(binaryFilepath, filenameWithVersion); err != nil {
@@ -473,6 +1071,7 @@ func (c *Config) WritePackage(p *Package, filename string, mode os.FileMode, dat
 	}
 	return nil
 }
+
 func (c *Config) WritePackageOld(p *Package, filename string, mode os.FileMode, data []byte) error {
 	filenameWithVersion := p.FilenameWithVersion(filename)
 	filenameWithVersionAndRecipe := fmt.Sprintf("%s_%s_%s", p.RecipeName, p.Version, filename)
@@ -517,7 +1116,15 @@ func (c *Config) WritePackageOld(p *Package, filename string, mode os.FileMode,
 }
 
 func (c *Config) SymlinkFile(symlink, filename string) error {
+	// Link relative to the output directory so that the install tree
+	// still works when it is copied somewhere else, ie: into a rootfs
+	// for another platform.
 	symlinkPath := symlink
+	if outputDir, err := filepath.Abs(c.OutputDir); err == nil {
+		if rel, err := filepath.Rel(outputDir, symlink); err == nil {
+			symlinkPath = rel
+		}
+	}
 	filePath := filepath.Join(c.OutputDir, filename)
 	logging.PrintCommand("remove %s", filePath)
 	os.Remove(filePath)
@@ -528,22 +1135,44 @@ func (c *Config) SymlinkFile(symlink, filename string) error {
 	return nil
 }
 
-func (c *Config) CreatePackages(arch, OS string) error {
+func (c *Config) CreatePackages(ctx context.Context, arch, OS string) error {
 	for _, i := range c.CurrentlyInstalled {
 		logging.PrintCommand("remove %s", i.AbsolutePath)
 		os.Remove(i.AbsolutePath)
 	}
+	// Move the current install tree out of the way rather than removing
+	// it, so that it can be restored if we get cancelled.
 	pacmDir := filepath.Join(c.OutputDir, "_pacm")
-	logging.PrintCommand("removeall %s", pacmDir)
-	os.RemoveAll(pacmDir)
+	backup, err := c.backupInstallTree(pacmDir)
+	if err != nil {
+		return err
+	}
 	failed := 0
 	for _, p := range c.Packages {
-		if err := c.CreatePackage(arch, OS, p); err != nil {
-			logging.ErrorLog("unable to create package %s@%s: %v", p.RecipeName, p.Version, err)
+		if ctx.Err() != nil {
+			break
+		}
+		if err := c.CreatePackage(ctx, arch, OS, p); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			logging.ErrorLog("unable to create package %s: %v", p, err)
 			failed += 1
+			// Don't leave a partially written package behind, put back
+			// whatever was installed before.
+			if rerr := backup.restoreDir(c.packageDir(p)); rerr != nil {
+				logging.ErrorLog("unable to restore %s: %v", p, rerr)
+			}
 			continue
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		if rerr := backup.restore(); rerr != nil {
+			logging.ErrorLog("unable to restore %s: %v", pacmDir, rerr)
+		}
+		return err
+	}
+	backup.discard()
 	if failed == 0 {
 		return nil
 	} else {
@@ -551,32 +1180,68 @@ func (c *Config) CreatePackages(arch, OS string) error {
 	}
 }
 
-func (c *Config) CreatePackagesForRecipe(recipeName, arch, OS string) error {
+func (c *Config) CreatePackagesForRecipe(ctx context.Context, recipeName, arch, OS string) error {
+	var (
+		pkgs []*Package
+		dirs []string
+	)
+	seen := map[string]bool{}
 	for _, p := range c.Packages {
 		if p.RecipeName != recipeName {
 			continue
 		}
-		if err := c.CreatePackage(arch, OS, p); err != nil {
-			return errors.Wrapf(err, "unable to create package %s@%s", p.RecipeName, p.Version)
+		pkgs = append(pkgs, p)
+		// Packages with version constraints can resolve to the same
+		// version as another package.
+		if dir := c.packageDir(p); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	backup, err := c.backupInstallTree(dirs...)
+	if err != nil {
+		return err
+	}
+	for _, p := range pkgs {
+		if err := c.CreatePackage(ctx, arch, OS, p); err != nil {
+			if rerr := backup.restore(); rerr != nil {
+				logging.ErrorLog("unable to restore packages for %s: %v", recipeName, rerr)
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrapf(err, "unable to create package %s", p)
 		}
 	}
+	backup.discard()
 	return nil
 }
 
+// packageDir is the directory in the install tree that a package is
+// extracted to.
+func (c *Config) packageDir(p *Package) string {
+	outPath := filepath.Join(c.OutputDir, fmt.Sprintf("_pacm/%s_%s", p.RecipeName, p.Version))
+	outPath, _ = filepath.Abs(outPath)
+	return outPath
+}
+
 func (c *Config) generateArchivePath(arch, OS string, r Recipe, versionName string) string {
 	return fmt.Sprintf("%s_%s_%s-%s", r.Name, versionName, arch, OS)
 }
 
-func (c *Config) getCachedOrDownload(arch, OS string, r Recipe, packageVersion string) ([]byte, error) {
+func (c *Config) getCachedOrDownload(ctx context.Context, arch, OS string, r Recipe, packageVersion string) ([]byte, error) {
 	var b []byte
 	archivePath := c.generateArchivePath(arch, OS, r, packageVersion)
 	// If we have don't an archive on disk, download and save to disk.
 	if ok := cache.Archives[archivePath]; !ok {
+		if c.Offline {
+			return nil, fmt.Errorf("%s@%s for %s/%s not in cache (offline mode)", r.Name, packageVersion, OS, arch)
+		}
 		url, err := r.generateURL(arch, OS, packageVersion)
 		if err != nil {
 			return nil, err
 		}
-		b, err = cache.DownloadAndSave(url, archivePath)
+		b, err = cache.DownloadAndSave(ctx, url, archivePath)
 		if err != nil {
 			return nil, err
 		}
@@ -590,18 +1255,43 @@ func (c *Config) getCachedOrDownload(arch, OS string, r Recipe, packageVersion s
 	return b, nil
 }
 
-func (c *Config) RemoveUnusedCachedArchivePackages(arch, OS string) {
-	cachedArchives := cache.Archives
-	usedArchives := map[string]bool{}
-	for _, p := range c.Packages {
-		r := c.RecipeForPackage(p)
-		archivePath := c.generateArchivePath(arch, OS, r, p.Version)
-		if ok := cachedArchives[archivePath]; ok {
-			usedArchives[archivePath] = true
+// cachedOrDownloadLocked is getCachedOrDownload for configs that might
+// not hold the cache lock, which is taken if the archive is downloaded.
+func (c *Config) cachedOrDownloadLocked(ctx context.Context, arch, OS string, r Recipe, packageVersion string) ([]byte, error) {
+	if !cache.Archives[c.generateArchivePath(arch, OS, r, packageVersion)] && !c.Offline {
+		unlock, err := c.lockCacheForWrite()
+		if err != nil {
+			return nil, err
 		}
+		defer unlock()
+	}
+	return c.getCachedOrDownload(ctx, arch, OS, r, packageVersion)
+}
+
+// FetchArchive makes sure that the archive for a recipe and version is
+// in the cache without installing it. Returns true if the archive needed
+// to be downloaded.
+func (c *Config) FetchArchive(ctx context.Context, arch, OS, recipeName, version string) (bool, error) {
+	r, ok := c.FindRecipe(recipeName)
+	if !ok {
+		return false, fmt.Errorf("unknown recipe %q", recipeName)
+	}
+	if cache.Archives[c.generateArchivePath(arch, OS, r, version)] {
+		return false, nil
+	}
+	if _, err := c.getCachedOrDownload(ctx, arch, OS, r, version); err != nil {
+		return false, err
 	}
-	for ap := range cachedArchives {
-		if ok := usedArchives[ap]; ok {
+	return true, nil
+}
+
+// RemoveUnusedCachedArchivePackages deletes the cached archives that
+// aren't for a package in the config. Archives for every platform are
+// kept, so that those fetched for another platform can still be installed
+// offline.
+func (c *Config) RemoveUnusedCachedArchivePackages() {
+	for ap := range cache.Archives {
+		if c.archiveInUse(ap) {
 			continue
 		}
 		filePath := cache.ArchiveFullPath(ap)
@@ -611,9 +1301,33 @@ func (c *Config) RemoveUnusedCachedArchivePackages(arch, OS string) {
 	}
 }
 
-func (c *Config) CreatePackage(arch, OS string, p *Package) error {
+// archiveInUse reports whether a cached archive is for a package in the
+// config, on any platform.
+func (c *Config) archiveInUse(archivePath string) bool {
+	for _, p := range c.Packages {
+		if p.Version == "" {
+			continue
+		}
+		r := c.RecipeForPackage(p)
+		prefix := fmt.Sprintf("%s_%s_", r.Name, p.Version)
+		if !strings.HasPrefix(archivePath, prefix) {
+			continue
+		}
+		// The rest is <arch>-<os>, see generateArchivePath.
+		archAndOS := strings.SplitN(strings.TrimPrefix(archivePath, prefix), "-", 2)
+		if len(archAndOS) == 2 && utils.IsValidOSArchPair(archAndOS[1]+"_"+archAndOS[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) CreatePackage(ctx context.Context, arch, OS string, p *Package) error {
+	if p.Version == "" {
+		return fmt.Errorf("%s hasn't been resolved to a version, run 'pacm update %s'", p, p.RecipeName)
+	}
 	r := c.RecipeForPackage(p)
-	b, err := c.getCachedOrDownload(arch, OS, r, p.Version)
+	b, err := c.getCachedOrDownload(ctx, arch, OS, r, p.Version)
 	if err != nil {
 		return err
 	}
@@ -621,123 +1335,218 @@ func (c *Config) CreatePackage(arch, OS string, p *Package) error {
 	// If the recipe is a binary then we just need to
 	// save it and we are done.
 	if r.IsBinary {
-		// TODO: Make the permissions configurable?
-		if err := c.WritePackage(p, r.BinaryName, 0755, b); err != nil {
-			return err
-		}
-		return nil
+		return c.installEntry(p, binaryRecipeEntry(r, b))
 	}
-	typ, err := filetype.Archive(b)
+	innerArchive, err := r.executeTemplate(r.InnerArchive, arch, OS, p.Version)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid inner_archive for recipe %q: %v", r.Name, err)
 	}
-	buf := bytes.NewReader(b)
-	switch t := typ.Extension; t {
-	case "zip":
-		if err := c.writeZIP(r, p, buf, int64(len(b))); err != nil {
-			return err
+	return limitError(c.extractArchive(ctx, arch, OS, r, p, b, innerArchive, c.extractLimits()))
+}
+
+// maxArchiveDepth is how deeply archives can be nested inside each other.
+const maxArchiveDepth = 4
+
+// packageWalkFunc is called for each entry that a package is installed
+// from. archiveName is the inner archive that the entry is in, or empty
+// for the downloaded archive.
+type packageWalkFunc func(archiveName string, e *archive.Entry, rdr io.Reader) error
+
+// nestedArchive is an archive inside of another archive.
+type nestedArchive struct {
+	name string
+	b    []byte
+}
+
+// walkPackage walks the entries that a package is installed from in the
+// archive b. When entries match innerArchive, or the only file in the
+// archive is another archive, the entries of those archives are walked
+// instead. Each archive is only walked once, so what is decompressed only
+// counts towards the limits once.
+func walkPackage(ctx context.Context, b []byte, name, innerArchive string, limits *extractLimits, depth int, fn packageWalkFunc) error {
+	if depth > maxArchiveDepth {
+		return fmt.Errorf("archives are nested more than %d deep", maxArchiveDepth)
+	}
+	var (
+		inner []nestedArchive
+		// Without innerArchive, entries are held back until it is known
+		// whether the only file is an archive.
+		holding     = innerArchive == ""
+		held        []*archive.Entry
+		heldArchive *nestedArchive
+	)
+	release := func() error {
+		holding = false
+		for _, e := range held {
+			var rdr io.Reader = bytes.NewReader(nil)
+			if heldArchive != nil && e.Type == archive.TypeFile {
+				rdr = bytes.NewReader(heldArchive.b)
+			}
+			if err := fn(name, e, rdr); err != nil {
+				return err
+			}
 		}
-	case "gz":
-		if err := c.writeGZ(r, p, buf); err != nil {
+		held, heldArchive = nil, nil
+		return nil
+	}
+	err := archive.Walk(ctx, bytes.NewReader(b), limits.size, func(e *archive.Entry, rdr io.Reader) error {
+		if innerArchive != "" {
+			ia, err := matchInnerArchive(e, rdr, innerArchive)
+			if ia != nil {
+				inner = append(inner, *ia)
+			}
 			return err
 		}
-	case "xz":
-		if err := c.writeXZ(r, p, buf); err != nil {
-			return err
+		if !holding {
+			return fn(name, e, rdr)
 		}
-	default:
-		return fmt.Errorf("unsupported archive %s", t)
-	}
-	return nil
-}
-
-func (c *Config) writeXZ(r Recipe, p *Package, buf io.Reader) error {
-	xzrdr, err := xz.NewReader(buf, 0)
+		if e.Type == archive.TypeFile && !e.Decompressed && heldArchive == nil {
+			// Only read the whole file if its header is an archive's.
+			typ, prdr := archive.Peek(rdr)
+			if typ != "" {
+				ib, err := ioutil.ReadAll(prdr)
+				if err != nil {
+					return err
+				}
+				heldArchive = &nestedArchive{name: e.Name, b: ib}
+				held = append(held, e)
+				return nil
+			}
+			rdr = prdr
+		}
+		if e.Type == archive.TypeFile {
+			// A second file, or a file that isn't an archive.
+			if err := release(); err != nil {
+				return err
+			}
+			return fn(name, e, rdr)
+		}
+		held = append(held, e)
+		if limits.maxEntries > 0 && len(held) > limits.maxEntries {
+			return release()
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	// TODO: This is duplicated from writeGZ functions, need
-	// to refactor. Should be easy since both are identical.
-	rdr := tar.NewReader(xzrdr)
-	for {
-		hdr, err := rdr.Next()
-		if err == io.EOF {
-			break
+	switch {
+	case innerArchive != "":
+		if len(inner) == 0 {
+			return fmt.Errorf("no archives match inner_archive %q", innerArchive)
 		}
-		if err != nil {
-			return err
+	case holding && heldArchive != nil:
+		inner = append(inner, *heldArchive)
+	default:
+		return release()
+	}
+	for _, ia := range inner {
+		logging.DebugLog("%s: extracting from inner archive\n", ia.name)
+		innerName := ia.name
+		if name != "" {
+			innerName = name + ": " + ia.name
 		}
-		if err := c.extractForPackage(r, p, hdr.Name, hdr.FileInfo(), rdr); err != nil {
+		// inner_archive only applies to the downloaded archive.
+		if err := walkPackage(ctx, ia.b, innerName, "", limits, depth+1, fn); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (c *Config) writeGZ(r Recipe, p *Package, buf io.Reader) error {
-	gzr, err := gzip.NewReader(buf)
+// matchInnerArchive returns the archive in e if it matches the pattern.
+func matchInnerArchive(e *archive.Entry, rdr io.Reader, pattern string) (*nestedArchive, error) {
+	if e.Type != archive.TypeFile || e.Decompressed {
+		return nil, nil
+	}
+	if ok, err := path.Match(pattern, e.Name); err != nil {
+		return nil, fmt.Errorf("invalid inner_archive %q: %v", pattern, err)
+	} else if !ok {
+		return nil, nil
+	}
+	typ, rdr := archive.Peek(rdr)
+	if typ == "" {
+		return nil, fmt.Errorf("%s matches inner_archive %q but isn't an archive", e.Name, pattern)
+	}
+	ib, err := ioutil.ReadAll(rdr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	rdr := tar.NewReader(gzr)
-	for {
-		hdr, err := rdr.Next()
-		if err == io.EOF {
-			break
+	return &nestedArchive{name: e.Name, b: ib}, nil
+}
+
+// extractArchive installs the package from the archive in b, following
+// the plan for each entry, see planPackage.
+func (c *Config) extractArchive(ctx context.Context, arch, OS string, r Recipe, p *Package, b []byte, innerArchive string, limits *extractLimits) error {
+	return planPackage(ctx, arch, OS, r, b, innerArchive, limits, func(pe plannedEntry) error {
+		if pe.err != nil {
+			return pe.err
 		}
-		if err != nil {
-			return err
+		return c.installEntry(p, pe)
+	})
+}
+
+// installEntry carries out the plan for an entry.
+func (c *Config) installEntry(p *Package, pe plannedEntry) error {
+	dir := c.packageDir(p)
+	e := pe.entry
+	for _, op := range pe.plan.ops {
+		name := filepath.FromSlash(op.name)
+		filename := filepath.Join(dir, name)
+		var err error
+		switch op.kind {
+		case opDir:
+			err = c.WriteLibrary(p, name, true, e.Mode, nil)
+		case opFile, opBinary:
+			var b []byte
+			if b, err = pe.contents(); err != nil {
+				return err
+			}
+			if op.kind == opFile {
+				err = c.WriteLibrary(p, name, false, e.Mode, b)
+			} else {
+				err = c.WritePackage(p, name, e.Mode, b)
+			}
+			if err == nil {
+				setModTime(filename, e.ModTime)
+			}
+		case opSymlink:
+			err = c.writeSymlink(p, filename, op.target)
+		case opHardlink:
+			err = c.writeHardlink(p, filename, filepath.Join(dir, filepath.FromSlash(op.target)))
+		case opLinkBinary:
+			err = c.linkBinary(p, filename, op.target)
 		}
-		if err := c.extractForPackage(r, p, hdr.Name, hdr.FileInfo(), rdr); err != nil {
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (c *Config) writeZIP(r Recipe, p *Package, buf io.ReaderAt, bufLen int64) error {
-	rdr, err := zip.NewReader(buf, bufLen)
-	if err != nil {
-		return err
-	}
-	for _, f := range rdr.File {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		if err := c.extractForPackage(r, p, f.Name, f.FileInfo(), rc); err != nil {
-			return err
-		}
-		rc.Close()
+// stripComponents removes the first n directories from name, returning
+// false if there is nothing left.
+func stripComponents(name string, n int) (string, bool) {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	if len(parts) <= n {
+		return "", false
 	}
-	return nil
+	return strings.Join(parts[n:], "/"), true
 }
 
-func (c *Config) extractForPackage(r Recipe, p *Package, filename string, fileInfo os.FileInfo, rdr io.Reader) error {
-	if utils.ShouldExtractLibrary(filename, r.LibraryPaths) {
-		logging.DebugLog("%s: should attempt to write library\n", filename)
-		b, err := ioutil.ReadAll(rdr)
-		if err != nil {
-			return err
-		}
-		if err := c.WriteLibrary(p, utils.NormalizePath(filename, r.LibraryPaths), fileInfo.IsDir(), fileInfo.Mode(), b); err != nil {
-			return err
-		}
+func isLink(e *archive.Entry) bool {
+	return e.Type == archive.TypeSymlink || e.Type == archive.TypeHardlink
+}
+
+// setModTime sets the modification time of a file written from an archive,
+// failing to do so isn't an error.
+func setModTime(filename string, t time.Time) {
+	if t.IsZero() {
+		return
 	}
-	if utils.ShouldExtract(filename, r.ExtractPaths) {
-		logging.DebugLog("%s: should attempt to extract\n", filename)
-		b, err := ioutil.ReadAll(rdr)
-		if err != nil {
-			return err
-		}
-		isExec := utils.IsExecutable(bytes.NewReader(b))
-		if isExec {
-			if err := c.WritePackage(p, fileInfo.Name(), fileInfo.Mode(), b); err != nil {
-				return err
-			}
-		}
+	if err := os.Chtimes(filename, t, t); err != nil {
+		logging.DebugLog("unable to set mtime of %s: %v\n", filename, err)
 	}
-	return nil
 }
 
 func (c *Config) populateCurrentlyInstalled() error {
@@ -0,0 +1,407 @@
+package config
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEntry is an entry in an archive built by a test. Entries are files
+// unless they have a trailing slash, which makes them directories, or a
+// Linkname.
+type testEntry struct {
+	Name     string
+	Body     string
+	Mode     int64
+	ModTime  time.Time
+	Linkname string
+	Hardlink bool
+}
+
+func tarGz(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:    e.Name,
+			Mode:    e.Mode,
+			ModTime: e.ModTime,
+			Size:    int64(len(e.Body)),
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if hdr.ModTime.IsZero() {
+			hdr.ModTime = time.Now()
+		}
+		switch {
+		case e.Hardlink:
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, e.Linkname, 0
+		case e.Linkname != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.Linkname, 0
+		case strings.HasSuffix(e.Name, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		default:
+			hdr.Typeflag = tar.TypeReg
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.Body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipFile(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		fh := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		fh.SetMode(0755)
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// extractTree installs the archive in b for a tree layout recipe into a
+// new output directory, returning the package directory.
+func extractTree(t *testing.T, r Recipe, b []byte) (*Config, string, error) {
+	t.Helper()
+	c := &Config{
+		OutputDir:         t.TempDir(),
+		MaxExtractSize:    DefaultMaxExtractSize,
+		MaxExtractEntries: DefaultMaxExtractEntries,
+	}
+	if r.Name == "" {
+		r.Name = "tool"
+	}
+	r.Layout = LayoutTree
+	p := &Package{RecipeName: r.Name, Version: "1.0.0", Active: true}
+	err := c.extractArchive(context.Background(), "amd64", "linux", r, p, b, r.InnerArchive, c.extractLimits())
+	return c, c.packageDir(p), err
+}
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestExtractInnerArchive(t *testing.T) {
+	inner := zipFile(t, map[string]string{"bin/tool": "tool\n"})
+	b := tarGz(t,
+		testEntry{Name: "README", Body: "readme\n"},
+		testEntry{Name: "dist/tool.zip", Body: string(inner)},
+	)
+	c, dir, err := extractTree(t, Recipe{InnerArchive: "dist/*.zip"}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "bin", "tool")); got != "tool\n" {
+		t.Errorf("bin/tool = %q, want %q", got, "tool\n")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "README")); !os.IsNotExist(err) {
+		t.Errorf("README from the outer archive was installed: %v", err)
+	}
+	if got := readFile(t, filepath.Join(c.OutputDir, "tool")); got != "tool\n" {
+		t.Errorf("linked tool = %q, want %q", got, "tool\n")
+	}
+}
+
+func TestExtractOnlyArchive(t *testing.T) {
+	inner := tarGz(t, testEntry{Name: "bin/tool", Body: "tool\n", Mode: 0755})
+	// The only file is an archive, so it is installed from instead.
+	b := tarGz(t,
+		testEntry{Name: "dist/"},
+		testEntry{Name: "dist/tool.tar.gz", Body: string(inner)},
+	)
+	_, dir, err := extractTree(t, Recipe{}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := installTree(t, dir); !reflect.DeepEqual(got, map[string]string{".": "dir", "bin": "dir", "bin/tool": "tool\n"}) {
+		t.Errorf("got %v, want only the inner archive installed", got)
+	}
+
+	// With another file, the archive is installed as it is.
+	b = tarGz(t,
+		testEntry{Name: "dist/"},
+		testEntry{Name: "dist/tool.tar.gz", Body: string(inner)},
+		testEntry{Name: "README", Body: "readme\n"},
+	)
+	_, dir, err = extractTree(t, Recipe{}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{".": "dir", "dist": "dir", "dist/tool.tar.gz": string(inner), "README": "readme\n"}
+	if got := installTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want the outer archive installed", got)
+	}
+}
+
+func TestExtractInnerArchiveErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		innerArchive string
+		b            []byte
+		want         string
+	}{
+		{
+			name:         "no match",
+			innerArchive: "*.zip",
+			b:            tarGz(t, testEntry{Name: "bin/tool", Body: "tool\n"}),
+			want:         `no archives match inner_archive "*.zip"`,
+		},
+		{
+			name:         "not an archive",
+			innerArchive: "*.zip",
+			b:            tarGz(t, testEntry{Name: "tool.zip", Body: "not a zip"}),
+			want:         "isn't an archive",
+		},
+	}
+	for _, tt := range tests {
+		_, _, err := extractTree(t, Recipe{InnerArchive: tt.innerArchive}, tt.b)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestExtractNestedTooDeep(t *testing.T) {
+	b := tarGz(t, testEntry{Name: "bin/tool", Body: "tool\n"})
+	for i := 0; i <= maxArchiveDepth; i++ {
+		b = tarGz(t, testEntry{Name: "nested.tar.gz", Body: string(b)})
+	}
+	_, _, err := extractTree(t, Recipe{}, b)
+	if err == nil || !strings.Contains(err.Error(), "nested more than") {
+		t.Fatalf("got %v, want an error for nesting too deep", err)
+	}
+
+	// One less level of nesting is extracted.
+	b = tarGz(t, testEntry{Name: "bin/tool", Body: "tool\n"})
+	for i := 0; i < maxArchiveDepth; i++ {
+		b = tarGz(t, testEntry{Name: "nested.tar.gz", Body: string(b)})
+	}
+	_, dir, err := extractTree(t, Recipe{}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "bin", "tool")); got != "tool\n" {
+		t.Errorf("bin/tool = %q, want %q", got, "tool\n")
+	}
+}
+
+func TestExtractTree(t *testing.T) {
+	b := tarGz(t,
+		testEntry{Name: "sdk-1.0.0/"},
+		testEntry{Name: "sdk-1.0.0/bin/sdk", Body: "sdk\n", Mode: 0755},
+		testEntry{Name: "sdk-1.0.0/libexec/helper", Body: "helper\n", Mode: 0755},
+		testEntry{Name: "sdk-1.0.0/lib/sdk.jar", Body: "jar\n"},
+	)
+	c, dir, err := extractTree(t, Recipe{StripComponents: 1, BinPaths: []string{"bin/*", "libexec/helper"}}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"bin/sdk":        "sdk\n",
+		"libexec/helper": "helper\n",
+		"lib/sdk.jar":    "jar\n",
+	} {
+		if got := readFile(t, filepath.Join(dir, filepath.FromSlash(name))); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sdk-1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("sdk-1.0.0 wasn't stripped: %v", err)
+	}
+	for _, name := range []string{"sdk", "sdk_1.0.0", "helper", "helper_1.0.0"} {
+		if got := readFile(t, filepath.Join(c.OutputDir, name)); !strings.HasSuffix(got, "\n") {
+			t.Errorf("%s wasn't linked to a bin_paths entry", name)
+		}
+	}
+	target, err := os.Readlink(filepath.Join(c.OutputDir, "sdk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("_pacm", "tool_1.0.0", "bin", "sdk"); target != want {
+		t.Errorf("sdk -> %s, want %s so that the tree can be moved", target, want)
+	}
+	if _, err := os.Lstat(filepath.Join(c.OutputDir, "sdk.jar")); !os.IsNotExist(err) {
+		t.Errorf("sdk.jar was linked without matching bin_paths: %v", err)
+	}
+}
+
+func TestExtractTreeLinks(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	b := tarGz(t,
+		testEntry{Name: "node-v1/bin/node", Body: "node\n", Mode: 0755, ModTime: mtime},
+		testEntry{Name: "node-v1/lib/node_modules/npm/bin/npm-cli.js", Body: "npm\n", Mode: 0755},
+		testEntry{Name: "node-v1/lib/node_modules/npm/package.json", Body: "{}\n", Mode: 0600},
+		testEntry{Name: "node-v1/bin/npm", Linkname: "../lib/node_modules/npm/bin/npm-cli.js"},
+		testEntry{Name: "node-v1/bin/nodejs", Linkname: "node-v1/bin/node", Hardlink: true},
+	)
+	c, dir, err := extractTree(t, Recipe{Name: "node", StripComponents: 1}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, "bin", "npm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.FromSlash("../lib/node_modules/npm/bin/npm-cli.js"); target != want {
+		t.Errorf("bin/npm -> %s, want %s", target, want)
+	}
+	if got := readFile(t, filepath.Join(c.OutputDir, "npm")); got != "npm\n" {
+		t.Errorf("linked npm = %q, want %q", got, "npm\n")
+	}
+
+	node, err := os.Stat(filepath.Join(dir, "bin", "node"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodejs, err := os.Stat(filepath.Join(dir, "bin", "nodejs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(node, nodejs) {
+		t.Errorf("bin/nodejs isn't a hardlink to bin/node")
+	}
+	if !node.ModTime().Equal(mtime) {
+		t.Errorf("bin/node mtime = %v, want %v", node.ModTime(), mtime)
+	}
+	if node.Mode().Perm() != 0755 {
+		t.Errorf("bin/node mode = %v, want %v", node.Mode().Perm(), os.FileMode(0755))
+	}
+	pkg, err := os.Stat(filepath.Join(dir, "lib", "node_modules", "npm", "package.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Mode().Perm() != 0600 {
+		t.Errorf("package.json mode = %v, want %v", pkg.Mode().Perm(), os.FileMode(0600))
+	}
+}
+
+func TestExtractTreeWritableModes(t *testing.T) {
+	// Zips made on Windows, or FAT, give everything 0777 or 0666.
+	b := tarGz(t,
+		testEntry{Name: "bin/tool", Body: "tool\n", Mode: 0777},
+		testEntry{Name: "README", Body: "readme\n", Mode: 0666},
+	)
+	_, dir, err := extractTree(t, Recipe{}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{"bin/tool": 0755, "README": 0644} {
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != want {
+			t.Errorf("%s mode = %v, want %v", name, fi.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestExtractTreeEscapingLinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry testEntry
+	}{
+		{"relative symlink", testEntry{Name: "bin/evil", Linkname: "../../../../etc/passwd"}},
+		{"absolute symlink", testEntry{Name: "bin/evil", Linkname: "/etc/passwd"}},
+		{"hardlink", testEntry{Name: "bin/evil", Linkname: "../etc/passwd", Hardlink: true}},
+	}
+	for _, tt := range tests {
+		b := tarGz(t, testEntry{Name: "bin/tool", Body: "tool\n"}, tt.entry)
+		_, dir, err := extractTree(t, Recipe{}, b)
+		if err == nil {
+			t.Errorf("%s: expected an error for %s -> %s", tt.name, tt.entry.Name, tt.entry.Linkname)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "bin", "evil")); !os.IsNotExist(err) {
+			t.Errorf("%s: bin/evil was created: %v", tt.name, err)
+		}
+	}
+}
+
+func TestExtractTreeThroughSymlinks(t *testing.T) {
+	// b/c/d/a and b/c/d/a/x look like they are inside of the package, but
+	// once b/c/d/a is a link to b, b/x links to the parent of the package
+	// and b/x/escaped would be written outside of it.
+	b := tarGz(t,
+		testEntry{Name: "b/c/d/a", Linkname: "../.."},
+		testEntry{Name: "b/c/d/a/x", Linkname: "../../.."},
+		testEntry{Name: "b/x/escaped", Body: "escaped\n"},
+	)
+	c, dir, err := extractTree(t, Recipe{}, b)
+	if err == nil {
+		t.Errorf("expected an error writing through symlinks")
+	}
+	escaped := filepath.Join(filepath.Dir(dir), "escaped")
+	if _, err := os.Lstat(escaped); !os.IsNotExist(err) {
+		t.Errorf("%s was written outside of the package: %v", escaped, err)
+	}
+	if _, err := os.Lstat(filepath.Join(c.OutputDir, "escaped")); !os.IsNotExist(err) {
+		t.Errorf("escaped was written to the output directory: %v", err)
+	}
+}
+
+func TestExtractSizeLimit(t *testing.T) {
+	big := strings.Repeat("\x00", 64<<10)
+	b := tarGz(t, testEntry{Name: "bin/tool", Body: "tool\n"}, testEntry{Name: "share/big", Body: big})
+	for _, layout := range []string{LayoutFlat, LayoutTree} {
+		c := &Config{OutputDir: t.TempDir(), MaxExtractSize: 32 << 10}
+		// share/big isn't installed with the flat layout, but is still
+		// decompressed.
+		r := Recipe{Name: "tool", Layout: layout}
+		p := &Package{RecipeName: "tool", Version: "1.0.0"}
+		err := limitError(c.extractArchive(context.Background(), "amd64", "linux", r, p, b, "", c.extractLimits()))
+		if err == nil || !strings.Contains(err.Error(), "see max_extract_size") {
+			t.Errorf("%s: got %v, want an error for max_extract_size", layout, err)
+		}
+	}
+
+	// Looking for inner archives mustn't count what is decompressed
+	// towards the limit twice.
+	b = tarGz(t, testEntry{Name: "bin/tool", Body: strings.Repeat("\x00", 20<<10)})
+	c := &Config{OutputDir: t.TempDir(), MaxExtractSize: 32 << 10}
+	r := Recipe{Name: "tool", Layout: LayoutTree}
+	p := &Package{RecipeName: "tool", Version: "1.0.0"}
+	if err := c.extractArchive(context.Background(), "amd64", "linux", r, p, b, "", c.extractLimits()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/vishen/pacm/archive"
+	"github.com/vishen/pacm/utils"
+)
+
+// InspectedEntry is an entry in a package's archive, and what installing
+// the package does with it.
+type InspectedEntry struct {
+	// Archive is the name of the inner archive that the entry is in, or
+	// empty for the downloaded archive.
+	Archive string
+	Entry   *archive.Entry
+
+	// Format is the executable format and arch of a file, ie: "elf amd64".
+	Format string
+
+	Installed bool
+	// Reason is why the entry is or isn't installed.
+	Reason string
+
+	// index is where the entry is in its archive.
+	index int
+}
+
+// Inspect explains what installing a recipe for arch and OS does with each
+// entry in its archive, from the plan that installing it follows. The archive is read from archivePath if it is set,
+// otherwise the archive for the version is downloaded. If installing would
+// fail, ie: an entry is outside of the archive or the archive is larger
+// than max_extract_size, the entries inspected are returned along with the
+// error the install fails with.
+func (c *Config) Inspect(ctx context.Context, arch, OS, recipeName, version, archivePath string) ([]InspectedEntry, error) {
+	r, ok := c.FindRecipe(recipeName)
+	if !ok {
+		return nil, fmt.Errorf("unknown recipe %q", recipeName)
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if archivePath != "" {
+		b, err = ioutil.ReadFile(archivePath)
+	} else {
+		b, err = c.cachedOrDownloadLocked(ctx, arch, OS, r, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.IsBinary {
+		return []InspectedEntry{inspectedEntry(binaryRecipeEntry(r, b), b)}, nil
+	}
+	innerArchive, err := r.executeTemplate(r.InnerArchive, arch, OS, version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inner_archive for recipe %q: %v", r.Name, err)
+	}
+	var (
+		entries []InspectedEntry
+		// The first entry that fails the install, the rest of the
+		// entries are still inspected.
+		failed error
+	)
+	err = planPackage(ctx, arch, OS, r, b, innerArchive, c.extractLimits(), func(pe plannedEntry) error {
+		if pe.err != nil {
+			ie := inspectedEntry(pe, nil)
+			ie.Reason = fmt.Sprintf("%v, which fails the install", limitError(pe.err))
+			entries = append(entries, ie)
+			if failed == nil {
+				failed = pe.err
+			}
+			return nil
+		}
+		var b []byte
+		if pe.entry.Type == archive.TypeFile {
+			var err error
+			if b, err = pe.contents(); err != nil {
+				// The install stops here too, so stop inspecting.
+				ie := inspectedEntry(pe, nil)
+				ie.Reason = fmt.Sprintf("%v, which fails the install", limitError(err))
+				entries = append(entries, ie)
+				return err
+			}
+		}
+		entries = append(entries, inspectedEntry(pe, b))
+		return nil
+	})
+	// Links to binaries are planned last, put them back where they are
+	// in the archive.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].index < entries[j].index
+	})
+	if err == nil {
+		err = failed
+	}
+	return entries, limitError(err)
+}
+
+// inspectedEntry returns what the plan for an entry does, b is the
+// contents of a file.
+func inspectedEntry(pe plannedEntry, b []byte) InspectedEntry {
+	ie := InspectedEntry{
+		Archive:   pe.archive,
+		Entry:     pe.entry,
+		Installed: pe.plan.installed(),
+		Reason:    pe.plan.reason,
+		index:     pe.index,
+	}
+	if b != nil {
+		ie.Format = utils.BinaryFormat(bytes.NewReader(b))
+	}
+	return ie
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// elfExecutable is the header of an amd64 linux executable, which is all
+// that is needed to be detected as one.
+func elfExecutable() string {
+	hdr := make([]byte, 64)
+	copy(hdr, "\x7fELF")
+	hdr[4], hdr[5], hdr[6] = 2, 1, 1            // 64 bit, little endian, version 1
+	binary.LittleEndian.PutUint16(hdr[16:], 2)  // ET_EXEC
+	binary.LittleEndian.PutUint16(hdr[18:], 62) // EM_X86_64
+	binary.LittleEndian.PutUint32(hdr[20:], 1)
+	binary.LittleEndian.PutUint16(hdr[52:], 64)
+	return string(hdr)
+}
+
+func inspect(t *testing.T, c *Config, r Recipe, archivePath string) ([]InspectedEntry, error) {
+	t.Helper()
+	c.Recipes = []Recipe{r}
+	return c.Inspect(context.Background(), "amd64", "linux", r.Name, "1.0.0", archivePath)
+}
+
+// reasons returns the reason for each entry by name, prefixed with
+// "installed: " for installed entries.
+func reasons(entries []InspectedEntry) map[string]string {
+	got := map[string]string{}
+	for _, ie := range entries {
+		reason := ie.Reason
+		if ie.Installed {
+			reason = "installed: " + reason
+		}
+		got[ie.Entry.Name] = reason
+	}
+	return got
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Recipe
+		want map[string]string
+	}{
+		{
+			name: "flat",
+			r:    Recipe{Name: "hello", ExtractPaths: []string{"hello/bin/*"}, LibraryPaths: []string{"hello/README"}},
+			want: map[string]string{
+				"hello/":          "doesn't match extract",
+				"hello/bin/hello": `matches extract "hello/bin/*", but it isn't an executable`,
+				"hello/README":    `installed: matches library_paths "hello/README", installed as hello/README`,
+			},
+		},
+		{
+			name: "tree",
+			r:    Recipe{Name: "hello", Layout: LayoutTree, StripComponents: 1},
+			want: map[string]string{
+				"hello/":          "removed by strip_components=1",
+				"hello/bin/hello": `installed: installed as bin/hello, linked as hello by bin_paths "bin/*"`,
+				"hello/README":    "installed: installed as README",
+			},
+		},
+	}
+	for _, archiveName := range []string{"hello.tar.gz", "hello.zip", "hello.deb"} {
+		archivePath := filepath.Join("..", "archive", "testdata", archiveName)
+		for _, tt := range tests {
+			entries, err := inspect(t, &Config{}, tt.r, archivePath)
+			if err != nil {
+				t.Fatalf("%s %s: %v", archiveName, tt.name, err)
+			}
+			got := reasons(entries)
+			for name, want := range tt.want {
+				if !strings.HasPrefix(got[name], want) {
+					t.Errorf("%s %s: %s = %q, want %q", archiveName, tt.name, name, got[name], want)
+				}
+			}
+		}
+	}
+}
+
+func TestInspectLibraryAndExtract(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "tool.tar.gz")
+	b := tarGz(t, testEntry{Name: "bin/tool", Body: elfExecutable(), Mode: 0755})
+	if err := ioutil.WriteFile(archivePath, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := Recipe{Name: "tool", ExtractPaths: []string{"bin/*"}, LibraryPaths: []string{"bin/*"}}
+	entries, err := inspect(t, &Config{}, r, archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `installed: matches library_paths "bin/*", installed as bin/tool, and as an executable for linux/amd64 matching extract "bin/*"`
+	if got := reasons(entries)["bin/tool"]; got != want {
+		t.Errorf("bin/tool = %q, want %q", got, want)
+	}
+}
+
+func TestInspectLimits(t *testing.T) {
+	archivePath := filepath.Join("..", "archive", "testdata", "hello.tar.gz")
+	r := Recipe{Name: "hello", Layout: LayoutTree}
+	tests := []struct {
+		name string
+		c    *Config
+		want string
+	}{
+		{"entries", &Config{MaxExtractEntries: 2}, "see max_extract_entries"},
+		{"size", &Config{MaxExtractSize: 1536}, "see max_extract_size"},
+	}
+	for _, tt := range tests {
+		entries, err := inspect(t, tt.c, r, archivePath)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.want)
+		}
+		for _, ie := range entries {
+			if !ie.Installed && !strings.HasSuffix(ie.Reason, "which fails the install") {
+				t.Errorf("%s: %s = %q, want it to fail the install", tt.name, ie.Entry.Name, ie.Reason)
+			}
+		}
+	}
+	entries, _ := inspect(t, &Config{MaxExtractEntries: 2}, r, archivePath)
+	if len(entries) != 4 {
+		t.Errorf("got %d entries, want all 4 to be inspected past the entries limit", len(entries))
+	}
+}
+
+func TestInspectMatchesInstall(t *testing.T) {
+	// The link comes before the executable it links to.
+	b := tarGz(t,
+		testEntry{Name: "bin/tool-link", Linkname: "tool"},
+		testEntry{Name: "bin/tool", Body: elfExecutable(), Mode: 0755},
+		testEntry{Name: "bin/script", Body: "#!/bin/sh\n", Mode: 0755},
+		testEntry{Name: "lib/tool.so", Body: "lib\n"},
+		testEntry{Name: "README", Body: "readme\n"},
+	)
+	archivePath := filepath.Join(t.TempDir(), "tool.tar.gz")
+	if err := ioutil.WriteFile(archivePath, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := Recipe{Name: "tool", ExtractPaths: []string{"bin/*"}, LibraryPaths: []string{"lib/*"}}
+	c := &Config{OutputDir: t.TempDir()}
+	entries, err := inspect(t, c, r, archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, installed []string
+	for _, ie := range entries {
+		names = append(names, ie.Entry.Name)
+		if ie.Installed {
+			installed = append(installed, ie.Entry.Name)
+		}
+	}
+	if want := []string{"bin/tool-link", "bin/tool", "bin/script", "lib/tool.so", "README"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got entries %v, want them in the order of the archive %v", names, want)
+	}
+	if want := []string{"bin/tool-link", "bin/tool", "lib/tool.so"}; !reflect.DeepEqual(installed, want) {
+		t.Errorf("got installed entries %v, want %v", installed, want)
+	}
+
+	p := &Package{RecipeName: "tool", Version: "1.0.0"}
+	if err := c.extractArchive(context.Background(), "amd64", "linux", r, p, b, "", c.extractLimits()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		".":           "dir",
+		"lib":         "dir",
+		"lib/tool.so": "lib\n",
+		"tool":        elfExecutable(),
+		"tool-link":   "-> tool",
+	}
+	if got := installTree(t, c.packageDir(p)); !reflect.DeepEqual(got, want) {
+		t.Errorf("installed %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/vishen/pacm/archive"
+)
+
+const (
+	// DefaultMaxExtractSize is the default for max_extract_size.
+	DefaultMaxExtractSize = 4 << 30
+	// DefaultMaxExtractEntries is the default for max_extract_entries.
+	DefaultMaxExtractEntries = 100000
+)
+
+// extractLimits guard against archive bombs by counting the entries and
+// uncompressed bytes read while installing a package, including those of
+// any nested archives.
+type extractLimits struct {
+	size       *archive.SizeLimit
+	maxEntries int
+
+	entries int
+}
+
+func (c *Config) extractLimits() *extractLimits {
+	return &extractLimits{
+		size:       &archive.SizeLimit{Max: c.MaxExtractSize},
+		maxEntries: c.MaxExtractEntries,
+	}
+}
+
+// limitError says which key in the config sets a limit that err is from.
+func limitError(err error) error {
+	var sizeErr *archive.SizeError
+	if errors.As(err, &sizeErr) {
+		return fmt.Errorf("%v, see max_extract_size", err)
+	}
+	return err
+}
+
+// entry counts an entry, and checks that it is safe to extract. The setuid
+// and setgid bits, and the group and other write bits, are removed from its
+// mode, as modes are set explicitly rather than through the umask.
+func (l *extractLimits) entry(e *archive.Entry) error {
+	l.entries++
+	if l.maxEntries > 0 && l.entries > l.maxEntries {
+		return fmt.Errorf("archive has more than %d entries, see max_extract_entries", l.maxEntries)
+	}
+	if e.Type == archive.TypeOther {
+		return fmt.Errorf("%s is a device or fifo, which can't be extracted", e.Name)
+	}
+	if !safePath(e.Name) {
+		return fmt.Errorf("%s is outside of the archive", e.Name)
+	}
+	if e.Type == archive.TypeHardlink && !safePath(e.Linkname) {
+		return fmt.Errorf("hardlink %s -> %s is outside of the archive", e.Name, e.Linkname)
+	}
+	e.Mode &^= os.ModeSetuid | os.ModeSetgid | 0022
+	return nil
+}
+
+// safePath reports whether an entry name stays within the directory it is
+// extracted to, ie: it isn't absolute and doesn't contain "..".
+func safePath(name string) bool {
+	name = strings.Replace(name, `\`, "/", -1)
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
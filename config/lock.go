@@ -0,0 +1,114 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+
+	pacmcache "github.com/vishen/pacm/cache"
+	"github.com/vishen/pacm/lock"
+	"github.com/vishen/pacm/logging"
+)
+
+// locksDir is the directory in the cache that lock files are kept in, so
+// that they are never written into the install directory.
+const locksDir = ".locks"
+
+// lockConfig takes the lock for the config file at path. It is kept in the
+// default cache directory, as the lock is needed before the config, and
+// its cache directory, have been read.
+func lockConfig(path string, wait time.Duration) (*lock.Lock, error) {
+	configPath, err := expandConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if configPath, err = filepath.Abs(configPath); err != nil {
+		return nil, err
+	}
+	cacheDir, err := pacmcache.Dir("")
+	if err != nil {
+		return nil, err
+	}
+	return lockFile(cacheDir, "config-"+hashPath(configPath), wait)
+}
+
+// lockDirs takes the locks for the cache directory and the output
+// directory.
+func (c *Config) lockDirs(wait time.Duration) ([]*lock.Lock, error) {
+	cacheDir, err := pacmcache.Dir(c.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{"cache"}
+	if c.OutputDir != "" {
+		outputDir, err := filepath.Abs(c.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, "dir-"+hashPath(outputDir))
+	}
+	var locks []*lock.Lock
+	for _, name := range names {
+		l, err := lockFile(cacheDir, name, wait)
+		if err != nil {
+			releaseLocks(locks)
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, nil
+}
+
+// lockCache takes the lock for the cache directory only.
+func lockCache(cacheDir string, wait time.Duration) (*lock.Lock, error) {
+	return lockFile(cacheDir, "cache", wait)
+}
+
+func lockFile(cacheDir, name string, wait time.Duration) (*lock.Lock, error) {
+	dir := filepath.Join(cacheDir, locksDir)
+	logging.PrintCommand("mkdirall %s 0755", dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return lock.Acquire(filepath.Join(dir, name+".lock"), wait)
+}
+
+// hashPath names the lock file for a path outside of the cache.
+func hashPath(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:8])
+}
+
+func releaseLocks(locks []*lock.Lock) {
+	for i := len(locks) - 1; i >= 0; i-- {
+		if err := locks[i].Release(); err != nil {
+			logging.ErrorLog("unable to release lock: %v", err)
+		}
+	}
+}
+
+// Unlock releases any locks taken when loading the config.
+func (c *Config) Unlock() {
+	releaseLocks(c.locks)
+	c.locks = nil
+}
+
+// lockCacheForWrite takes the cache lock before writing to the cache, for
+// configs that weren't loaded with LoadOptions.Lock. The returned func
+// releases it.
+func (c *Config) lockCacheForWrite() (func(), error) {
+	if len(c.locks) > 0 {
+		return func() {}, nil
+	}
+	cacheDir, err := pacmcache.Dir(c.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	l, err := lockCache(cacheDir, c.lockWait)
+	if err != nil {
+		return nil, err
+	}
+	return func() { l.Release() }, nil
+}
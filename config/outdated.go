@@ -0,0 +1,113 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/vishen/pacm/version"
+)
+
+// How many recipes to look up releases for at once.
+const outdatedConcurrency = 8
+
+// OutdatedOptions controls which releases are used when looking for newer
+// versions of a recipe.
+type OutdatedOptions struct {
+	// Prereleases are newer versions as well, otherwise they are ignored.
+	Prereleases bool
+	// Drafts includes draft releases.
+	Drafts bool
+}
+
+// RecipeStatus summarises the installed and available versions of a
+// recipe. Versions are empty if there isn't one.
+type RecipeStatus struct {
+	Recipe string
+
+	Active          string
+	NewestInstalled string
+
+	NewestStable     string
+	NewestPrerelease string
+
+	// Outdated is set if there is a release newer than the active
+	// version, or the newest installed if none are active.
+	Outdated bool
+
+	// Err is set if the release source couldn't be used, the rest of
+	// the status is from what else is known.
+	Err error
+}
+
+// RecipeStatuses returns the status of the recipes with the given names,
+// in the same order.
+func (c *Config) RecipeStatuses(ctx context.Context, names []string, opts OutdatedOptions) []RecipeStatus {
+	statuses := make([]RecipeStatus, len(names))
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, outdatedConcurrency)
+	)
+	for i, name := range names {
+		r, ok := c.FindRecipe(name)
+		if !ok {
+			statuses[i] = RecipeStatus{Recipe: name, Err: fmt.Errorf("unknown recipe %q", name)}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, r Recipe) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			statuses[i] = c.recipeStatus(ctx, r, opts)
+		}(i, r)
+	}
+	wg.Wait()
+	return statuses
+}
+
+func (c *Config) recipeStatus(ctx context.Context, r Recipe, opts OutdatedOptions) RecipeStatus {
+	s := RecipeStatus{Recipe: r.Name}
+	versions, err := c.RecipeVersions(ctx, r)
+	s.Err = err
+
+	// Versions are sorted newest first, so the first match is the
+	// newest.
+	for _, rv := range versions {
+		if rv.Active && s.Active == "" {
+			s.Active = rv.Version
+		}
+		if rv.Installed && s.NewestInstalled == "" {
+			s.NewestInstalled = rv.Version
+		}
+		if rv.Release == nil && !rv.hasSource(VersionSourceStatic) {
+			continue
+		}
+		if rv.Release != nil && rv.Release.Draft && !opts.Drafts {
+			continue
+		}
+		prerelease := isPrerelease(rv.Version, rv.Release)
+		switch {
+		case !prerelease && s.NewestStable == "":
+			s.NewestStable = rv.Version
+		case prerelease && opts.Prereleases && s.NewestPrerelease == "" && s.NewestStable == "":
+			// Only prereleases newer than the newest stable release
+			// are interesting.
+			s.NewestPrerelease = rv.Version
+		}
+	}
+
+	current := s.Active
+	if current == "" {
+		current = s.NewestInstalled
+	}
+	if current == "" {
+		return s
+	}
+	for _, v := range []string{s.NewestStable, s.NewestPrerelease} {
+		if v != "" && version.Compare(v, current) > 0 {
+			s.Outdated = true
+		}
+	}
+	return s
+}
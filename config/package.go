@@ -12,8 +12,22 @@ type Package struct {
 	Active         bool   `json:"active"`
 	Version        string `json:"version"`
 	ExecutableName string `json:"executable_name"`
+
+	// Constraint is set when the package section is a version constraint
+	// or channel, ie: [terraform@~0.12]. Version is then the version it
+	// was last resolved to, and is empty if it hasn't been resolved yet.
+	Constraint string `json:"constraint,omitempty"`
 }
 
 func (p Package) FilenameWithVersion(filename string) string {
 	return fmt.Sprintf("%s_%s", filename, p.Version)
 }
+
+// String returns the package as it is written in the config, ie:
+// terraform@0.12.0 or terraform@~0.12.
+func (p Package) String() string {
+	if p.Constraint != "" {
+		return fmt.Sprintf("%s@%s", p.RecipeName, p.Constraint)
+	}
+	return fmt.Sprintf("%s@%s", p.RecipeName, p.Version)
+}
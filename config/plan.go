@@ -0,0 +1,376 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/vishen/pacm/archive"
+	"github.com/vishen/pacm/utils"
+)
+
+// opKind is what an installOp does.
+type opKind int
+
+const (
+	// opDir creates the directory name.
+	opDir opKind = iota
+	// opFile writes the contents of the entry to name.
+	opFile
+	// opBinary writes the contents of the entry to name, and links it
+	// into the output directory under the same name.
+	opBinary
+	// opSymlink creates a symlink at name that points to target.
+	opSymlink
+	// opHardlink creates a hardlink at name to the file at target.
+	opHardlink
+	// opLinkBinary links name into the output directory as target.
+	opLinkBinary
+)
+
+// installOp is one step of installing an entry. Names, and the targets of
+// hardlinks, are slash separated paths in the package directory.
+type installOp struct {
+	kind   opKind
+	name   string
+	target string
+}
+
+// entryPlan is what installing a package does with an entry in its
+// archive. Installing and inspecting a package both follow the plans, so
+// that inspect explains what installing really does.
+type entryPlan struct {
+	// ops install the entry, there are none if it isn't installed.
+	ops []installOp
+	// reason is why the entry is or isn't installed.
+	reason string
+}
+
+func (p entryPlan) installed() bool {
+	return len(p.ops) > 0
+}
+
+// plannedEntry is an entry that a package is installed from, and the plan
+// for it.
+type plannedEntry struct {
+	// archive is the inner archive that the entry is in, or empty for the
+	// downloaded archive.
+	archive string
+	entry   *archive.Entry
+	plan    entryPlan
+	// err is why installing the entry fails the install.
+	err error
+	// index is where the entry is in the walk, links to binaries are
+	// planned after the entries that follow them.
+	index int
+	// contents reads the contents of a file, and is only valid until
+	// the function the entry is passed to returns.
+	contents func() ([]byte, error)
+}
+
+// entryContents reads the contents of an entry the first time they are
+// needed, so that files which aren't installed aren't kept in memory.
+type entryContents struct {
+	r    io.Reader
+	read bool
+	b    []byte
+	err  error
+}
+
+func (ec *entryContents) bytes() ([]byte, error) {
+	if !ec.read {
+		ec.read = true
+		ec.b, ec.err = ioutil.ReadAll(ec.r)
+	}
+	return ec.b, ec.err
+}
+
+// planPackage plans the install of each entry that a package for r is
+// installed from in the archive b, see walkPackage, and calls fn with the
+// plan. Links to binaries are planned once the walk is done, so that the
+// binaries they link to have been. Entries that fail the install are
+// passed to fn with their error, and it decides whether to go on.
+func planPackage(ctx context.Context, arch, OS string, r Recipe, b []byte, innerArchive string, limits *extractLimits, fn func(pe plannedEntry) error) error {
+	var (
+		index int
+		links []plannedEntry
+		// The files installed at the top of the package directory, which
+		// are what links to binaries can point at.
+		installed = map[string]bool{}
+	)
+	err := walkPackage(ctx, b, "", innerArchive, limits, 0, func(name string, e *archive.Entry, rdr io.Reader) error {
+		ec := &entryContents{r: rdr}
+		pe := plannedEntry{archive: name, entry: e, index: index, contents: ec.bytes}
+		index++
+		if pe.err = limits.entry(e); pe.err != nil {
+			return fn(pe)
+		}
+		switch {
+		case r.Layout == LayoutTree:
+			pe.plan, pe.err = planTreeEntry(r, e)
+		case isBinaryLink(r, e):
+			links = append(links, pe)
+			return nil
+		default:
+			pe.plan, pe.err = planEntry(arch, OS, r, e, ec.bytes)
+		}
+		if ec.err != nil {
+			// Nothing past an entry that can't be read is installed.
+			pe.err = ec.err
+			if err := fn(pe); err != nil {
+				return err
+			}
+			return ec.err
+		}
+		for _, op := range pe.plan.ops {
+			if (op.kind == opFile || op.kind == opBinary) && !strings.Contains(op.name, "/") {
+				installed[op.name] = true
+			}
+		}
+		return fn(pe)
+	})
+	if err != nil {
+		return err
+	}
+	for _, pe := range links {
+		pe.plan = planBinaryLink(r, pe.entry, installed)
+		// Hardlinks are files that later links can point at.
+		if pe.entry.Type == archive.TypeHardlink && pe.plan.installed() {
+			installed[path.Base(pe.entry.Name)] = true
+		}
+		if err := fn(pe); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// binaryRecipeEntry plans the install of b, the downloaded file of a
+// binary recipe.
+func binaryRecipeEntry(r Recipe, b []byte) plannedEntry {
+	return plannedEntry{
+		// TODO: Make the permissions configurable?
+		entry: &archive.Entry{Type: archive.TypeFile, Mode: 0755, Size: int64(len(b))},
+		plan: entryPlan{
+			ops:    []installOp{{kind: opBinary, name: r.BinaryName}},
+			reason: fmt.Sprintf("binary recipe, installed as %s", r.BinaryName),
+		},
+		contents: func() ([]byte, error) { return b, nil },
+	}
+}
+
+// planTreeEntry plans the install of an entry at its path in the archive,
+// less the recipe's strip_components, linking it into the output directory
+// if it matches the recipe's bin_paths.
+func planTreeEntry(r Recipe, e *archive.Entry) (entryPlan, error) {
+	if e.Decompressed {
+		return entryPlan{}, fmt.Errorf("layout=%s needs an archive, not a single compressed file", LayoutTree)
+	}
+	name, ok := stripComponents(e.Name, r.StripComponents)
+	if !ok {
+		return entryPlan{reason: fmt.Sprintf("removed by strip_components=%d", r.StripComponents)}, nil
+	}
+	var op installOp
+	switch e.Type {
+	case archive.TypeDir:
+		return entryPlan{
+			ops:    []installOp{{kind: opDir, name: name}},
+			reason: fmt.Sprintf("installed as %s", name),
+		}, nil
+	case archive.TypeFile:
+		op = installOp{kind: opFile, name: name}
+	case archive.TypeSymlink:
+		if symlinkEscapes(name, e.Linkname) {
+			return entryPlan{}, fmt.Errorf("symlink %s -> %s points outside of the package", e.Name, e.Linkname)
+		}
+		op = installOp{kind: opSymlink, name: name, target: e.Linkname}
+	case archive.TypeHardlink:
+		target, ok := stripComponents(e.Linkname, r.StripComponents)
+		if !ok {
+			return entryPlan{}, fmt.Errorf("hardlink %s -> %s points outside of the package", e.Name, e.Linkname)
+		}
+		op = installOp{kind: opHardlink, name: name, target: target}
+	default:
+		return entryPlan{reason: fmt.Sprintf("is a %s, which isn't installed", e.Type)}, nil
+	}
+	plan := entryPlan{ops: []installOp{op}, reason: fmt.Sprintf("installed as %s", name)}
+	binPaths := r.BinPaths
+	if len(binPaths) == 0 {
+		binPaths = defaultBinPaths
+	}
+	for _, bp := range binPaths {
+		if ok, _ := path.Match(strings.TrimSpace(bp), name); ok {
+			plan.ops = append(plan.ops, installOp{kind: opLinkBinary, name: name, target: path.Base(name)})
+			plan.reason += fmt.Sprintf(", linked as %s by bin_paths %q", path.Base(name), bp)
+			break
+		}
+	}
+	return plan, nil
+}
+
+// planEntry plans the install of an entry for the flat layout, where only
+// the executables matching the recipe's extract are installed, along with
+// what matches its library_paths. An entry can be installed as both.
+func planEntry(arch, OS string, r Recipe, e *archive.Entry, contents func() ([]byte, error)) (entryPlan, error) {
+	if e.Decompressed {
+		b, err := contents()
+		if err != nil {
+			return entryPlan{}, err
+		}
+		return planCompressedBinary(arch, OS, r, b)
+	}
+	var plan entryPlan
+	if pattern, ok := utils.MatchingPath(e.Name, r.LibraryPaths); ok {
+		lp, err := planLibrary(r, e, pattern)
+		if err != nil {
+			return entryPlan{}, err
+		}
+		plan = lp
+	}
+	extractPaths := utils.ExtractPaths(r.ExtractPaths)
+	pattern, ok := utils.MatchingPath(e.Name, extractPaths)
+	if !ok {
+		if plan.reason != "" {
+			return plan, nil
+		}
+		reason := fmt.Sprintf("doesn't match extract %q", strings.Join(extractPaths, ","))
+		if len(r.LibraryPaths) > 0 {
+			reason += fmt.Sprintf(" or library_paths %q", strings.Join(r.LibraryPaths, ","))
+		}
+		return entryPlan{reason: reason}, nil
+	}
+	if e.Type != archive.TypeFile {
+		// Links in the library paths are only installed as libraries.
+		if plan.reason != "" {
+			return plan, nil
+		}
+		return entryPlan{reason: fmt.Sprintf("matches extract %q, but is a %s", pattern, e.Type)}, nil
+	}
+	b, err := contents()
+	if err != nil {
+		return entryPlan{}, err
+	}
+	if !utils.IsExecutable(bytes.NewReader(b), arch, OS) {
+		if plan.reason != "" {
+			return plan, nil
+		}
+		return entryPlan{reason: fmt.Sprintf("matches extract %q, but %s", pattern, notExecutableReason(arch, OS, b))}, nil
+	}
+	plan.ops = append(plan.ops, installOp{kind: opBinary, name: path.Base(e.Name)})
+	if plan.reason != "" {
+		plan.reason += fmt.Sprintf(", and as an executable for %s/%s matching extract %q", OS, arch, pattern)
+	} else {
+		plan.reason = fmt.Sprintf("executable for %s/%s matching extract %q", OS, arch, pattern)
+	}
+	return plan, nil
+}
+
+// planLibrary plans the install of an entry matching pattern, one of the
+// recipe's library_paths.
+func planLibrary(r Recipe, e *archive.Entry, pattern string) (entryPlan, error) {
+	name := utils.NormalizePath(e.Name, r.LibraryPaths)
+	var op installOp
+	switch e.Type {
+	case archive.TypeDir:
+		op = installOp{kind: opDir, name: name}
+	case archive.TypeFile:
+		op = installOp{kind: opFile, name: name}
+	case archive.TypeSymlink:
+		if symlinkEscapes(name, e.Linkname) {
+			return entryPlan{}, fmt.Errorf("symlink %s -> %s points outside of the package", e.Name, e.Linkname)
+		}
+		op = installOp{kind: opSymlink, name: name, target: e.Linkname}
+	case archive.TypeHardlink:
+		if !utils.ShouldExtractLibrary(e.Linkname, r.LibraryPaths) {
+			return entryPlan{}, fmt.Errorf("hardlink %s -> %s points outside of the library paths", e.Name, e.Linkname)
+		}
+		op = installOp{kind: opHardlink, name: name, target: utils.NormalizePath(e.Linkname, r.LibraryPaths)}
+	default:
+		return entryPlan{reason: fmt.Sprintf("matches library_paths %q, but is a %s", pattern, e.Type)}, nil
+	}
+	return entryPlan{
+		ops:    []installOp{op},
+		reason: fmt.Sprintf("matches library_paths %q, installed as %s", pattern, name),
+	}, nil
+}
+
+// planCompressedBinary plans the install of a binary that was compressed
+// on its own, ie: tool-linux-amd64.gz, as the recipe's binary_name, or the
+// name of the recipe if it doesn't have one.
+func planCompressedBinary(arch, OS string, r Recipe, b []byte) (entryPlan, error) {
+	if !utils.IsExecutable(bytes.NewReader(b), arch, OS) {
+		return entryPlan{}, fmt.Errorf("decompressed file isn't an archive or an executable for %s/%s", OS, arch)
+	}
+	name := compressedBinaryName(r)
+	return entryPlan{
+		ops:    []installOp{{kind: opBinary, name: name}},
+		reason: fmt.Sprintf("decompressed executable for %s/%s, installed as %s", OS, arch, name),
+	}, nil
+}
+
+func compressedBinaryName(r Recipe) string {
+	if r.BinaryName != "" {
+		return r.BinaryName
+	}
+	return r.Name
+}
+
+// isBinaryLink reports whether e is a link matching the recipe's extract,
+// that is installed if what it links to is, ie: bin/tool -> tool-1.2.0.
+func isBinaryLink(r Recipe, e *archive.Entry) bool {
+	return isLink(e) && !utils.ShouldExtractLibrary(e.Name, r.LibraryPaths) && utils.ShouldExtract(e.Name, r.ExtractPaths)
+}
+
+// planBinaryLink plans the install of a link to a binary, under the name
+// of the link, if the binary is in installed.
+func planBinaryLink(r Recipe, e *archive.Entry, installed map[string]bool) entryPlan {
+	pattern, _ := utils.MatchingPath(e.Name, utils.ExtractPaths(r.ExtractPaths))
+	if e.Type == archive.TypeSymlink && path.IsAbs(e.Linkname) {
+		return entryPlan{reason: fmt.Sprintf("matches extract %q, but links to the absolute path %s", pattern, e.Linkname)}
+	}
+	target := e.Linkname
+	if e.Type == archive.TypeSymlink {
+		target = path.Join(path.Dir(e.Name), e.Linkname)
+	}
+	targetName := path.Base(target)
+	if !installed[targetName] {
+		return entryPlan{reason: fmt.Sprintf("matches extract %q, but links to %s which isn't installed", pattern, e.Linkname)}
+	}
+	name := path.Base(e.Name)
+	if name == targetName {
+		return entryPlan{reason: fmt.Sprintf("links to the installed executable %s, which has the same name", targetName)}
+	}
+	kind := opHardlink
+	if e.Type == archive.TypeSymlink {
+		kind = opSymlink
+	}
+	return entryPlan{
+		ops: []installOp{
+			{kind: kind, name: name, target: targetName},
+			{kind: opLinkBinary, name: name, target: name},
+		},
+		reason: fmt.Sprintf("links to the installed executable %s", targetName),
+	}
+}
+
+func notExecutableReason(arch, OS string, b []byte) string {
+	if format := utils.BinaryFormat(bytes.NewReader(b)); format != "" {
+		return fmt.Sprintf("it is %s, not an executable for %s/%s", format, OS, arch)
+	}
+	return "it isn't an executable"
+}
+
+// symlinkEscapes reports whether a symlink at name in the package directory
+// points outside of it. writeSymlink also refuses links that only escape
+// through other links already in the package directory.
+func symlinkEscapes(name, target string) bool {
+	if path.IsAbs(target) || !upThenDown(target) {
+		return true
+	}
+	resolved := path.Join(path.Dir(strings.TrimSuffix(name, "/")), target)
+	return resolved == "." || resolved == ".." || strings.HasPrefix(resolved, "../")
+}
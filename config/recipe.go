@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"html/template"
 	"strings"
+
+	"github.com/vishen/pacm/releases"
 )
 
 var (
@@ -21,7 +23,22 @@ var (
 	}
 )
 
+const (
+	// LayoutFlat installs only the executables in the archive, along
+	// with any library paths.
+	LayoutFlat = "flat"
+	// LayoutTree installs the whole archive, keeping its directory
+	// layout, and links its entry points into the output directory.
+	LayoutTree = "tree"
+)
+
+var defaultBinPaths = []string{"bin/*"}
+
 type Recipe struct {
+	// Path to the recipe file this recipe was loaded from, empty
+	// if it was declared in the config file.
+	source string
+
 	Name string
 	URL  string
 
@@ -33,7 +50,39 @@ type Recipe struct {
 	ExtractPaths []string
 	LibraryPaths []string
 
-	ReleasesGithub string
+	// InnerArchive matches the archives inside of the downloaded archive
+	// that the package is extracted from, ie: a zip containing a tar.gz.
+	// It is a template like URL.
+	InnerArchive string
+
+	// Layout is how the package is installed, either LayoutFlat or
+	// LayoutTree.
+	Layout string
+	// StripComponents is the number of leading directories removed from
+	// each path when the layout is LayoutTree.
+	StripComponents int
+	// BinPaths match the entry points that are symlinked into the output
+	// directory when the layout is LayoutTree.
+	BinPaths []string
+
+	// Versions that are known to exist, for recipes that don't have
+	// a release source.
+	Versions []string
+
+	// Where to look up releases from, only one of these should be set.
+	ReleasesGithub    string
+	ReleasesGitlab    string
+	ReleasesGitlabURL string
+	ReleasesGitea     string
+	ReleasesGiteaURL  string
+
+	// Generic release sources that scrape versions from a json document
+	// or a page, ie: a directory listing.
+	ReleasesJSON       string
+	ReleasesJSONPath   string
+	ReleasesJSONRegex  string
+	ReleasesIndex      string
+	ReleasesIndexRegex string
 
 	// This is only used for mapping archs and os strings to
 	// other variations.
@@ -44,6 +93,44 @@ type Recipe struct {
 	Checksum     string
 }
 
+// releaseSourceKeys returns the keys of the release sources set in the
+// recipe, of which there should only be one.
+func (r Recipe) releaseSourceKeys() []string {
+	var keys []string
+	for _, s := range []struct {
+		key, value string
+	}{
+		{"releases_github", r.ReleasesGithub},
+		{"releases_gitlab", r.ReleasesGitlab},
+		{"releases_gitea", r.ReleasesGitea},
+		{"releases_json", r.ReleasesJSON},
+		{"releases_index", r.ReleasesIndex},
+	} {
+		if s.value != "" {
+			keys = append(keys, s.key)
+		}
+	}
+	return keys
+}
+
+// ReleaseSource returns where the releases for the recipe can be looked up
+// from, or nil if the recipe doesn't declare one.
+func (r Recipe) ReleaseSource(client *releases.Client) (releases.Source, error) {
+	switch {
+	case r.ReleasesGithub != "":
+		return client.Github(r.ReleasesGithub), nil
+	case r.ReleasesGitlab != "":
+		return client.Gitlab(r.ReleasesGitlabURL, r.ReleasesGitlab), nil
+	case r.ReleasesGitea != "":
+		return client.Gitea(r.ReleasesGiteaURL, r.ReleasesGitea), nil
+	case r.ReleasesJSON != "":
+		return client.JSON(r.ReleasesJSON, r.ReleasesJSONPath, r.ReleasesJSONRegex)
+	case r.ReleasesIndex != "":
+		return client.Index(r.ReleasesIndex, r.ReleasesIndexRegex)
+	}
+	return nil, nil
+}
+
 func (r Recipe) archAndOSAlternatives(arch, os string) (string, string) {
 	archAlt := archAlternatives[arch]
 	if archAlt == "" {
@@ -57,7 +144,11 @@ func (r Recipe) archAndOSAlternatives(arch, os string) (string, string) {
 }
 
 func (r Recipe) generateURL(arch, os, packageVersion string) (string, error) {
-	tmpl, err := template.New("recipe-" + r.Name).Parse(r.URL)
+	return r.executeTemplate(r.URL, arch, os, packageVersion)
+}
+
+func (r Recipe) executeTemplate(text, arch, os, packageVersion string) (string, error) {
+	tmpl, err := template.New("recipe-" + r.Name).Parse(text)
 	if err != nil {
 		return "", err
 	}
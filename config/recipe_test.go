@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateReleaseSources(t *testing.T) {
+	tests := []struct {
+		r    Recipe
+		want string
+	}{
+		{Recipe{Name: "tool"}, ""},
+		{Recipe{Name: "tool", ReleasesGithub: "owner/tool"}, ""},
+		{
+			Recipe{Name: "tool", ReleasesGithub: "owner/tool", ReleasesJSON: "https://example.com/tool.json"},
+			`recipe "tool" has more than one release source, only one of releases_github, releases_json is allowed`,
+		},
+	}
+	for _, tt := range tests {
+		err := (&Config{Recipes: []Recipe{tt.r}}).Validate()
+		if tt.want == "" && err != nil {
+			t.Errorf("%+v: %v", tt.r, err)
+		} else if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%+v: got %v, want %q", tt.r, err, tt.want)
+		}
+	}
+}
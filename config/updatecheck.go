@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/vishen/pacm/logging"
+	"github.com/vishen/pacm/version"
+)
+
+// UpdateCheck is what the last background check for newer releases found,
+// it is kept in the cache directory.
+type UpdateCheck struct {
+	CheckedAt time.Time `json:"checked_at"`
+
+	// Newest is the newest stable version of each recipe with an
+	// installed package.
+	Newest map[string]string `json:"newest"`
+}
+
+func updateCheckPath() string {
+	return filepath.Join(cache.Path(), ".update-check.json")
+}
+
+// LoadUpdateCheck returns the result of the last update check, or an empty
+// UpdateCheck if there hasn't been one.
+func (c *Config) LoadUpdateCheck() *UpdateCheck {
+	uc := &UpdateCheck{Newest: map[string]string{}}
+	b, err := ioutil.ReadFile(updateCheckPath())
+	if err != nil {
+		return uc
+	}
+	if err := json.Unmarshal(b, uc); err != nil {
+		logging.DebugLog("ignoring invalid %s: %v\n", updateCheckPath(), err)
+		return &UpdateCheck{Newest: map[string]string{}}
+	}
+	return uc
+}
+
+// Due reports whether it is time to check for updates again.
+func (uc *UpdateCheck) Due(interval time.Duration) bool {
+	return time.Since(uc.CheckedAt) >= interval
+}
+
+// Outdated returns the recipes whose active package is older than the
+// newest version found by the update check, sorted by name.
+func (c *Config) Outdated(uc *UpdateCheck) []string {
+	var outdated []string
+	for _, p := range c.Packages {
+		if !p.Active || p.Version == "" {
+			continue
+		}
+		if newest := uc.Newest[p.RecipeName]; newest != "" && version.Compare(newest, p.Version) > 0 {
+			outdated = append(outdated, p.RecipeName)
+		}
+	}
+	sort.Strings(outdated)
+	return outdated
+}
+
+// SaveUpdateCheck writes the update check to the cache directory.
+func (c *Config) SaveUpdateCheck(uc *UpdateCheck) error {
+	b, err := json.Marshal(uc)
+	if err != nil {
+		return err
+	}
+	path := updateCheckPath()
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".update-check-")
+	if err != nil {
+		return err
+	}
+	logging.PrintCommand("writefile %s 0644", path)
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CheckForUpdates looks up the newest stable version of every recipe with
+// an installed package and saves it as the update check.
+func (c *Config) CheckForUpdates(ctx context.Context) error {
+	seen := map[string]bool{}
+	var names []string
+	for _, p := range c.Packages {
+		if !seen[p.RecipeName] {
+			seen[p.RecipeName] = true
+			names = append(names, p.RecipeName)
+		}
+	}
+	uc := &UpdateCheck{
+		CheckedAt: time.Now(),
+		Newest:    map[string]string{},
+	}
+	for _, s := range c.RecipeStatuses(ctx, names, OutdatedOptions{}) {
+		if s.Err != nil {
+			logging.DebugLog("%s: %v\n", s.Recipe, s.Err)
+		}
+		if s.NewestStable != "" {
+			uc.Newest[s.Recipe] = s.NewestStable
+		}
+	}
+	return c.SaveUpdateCheck(uc)
+}
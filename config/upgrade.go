@@ -0,0 +1,244 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishen/pacm/logging"
+	"github.com/vishen/pacm/version"
+)
+
+// Upgrade is the result of upgrading a recipe.
+type Upgrade struct {
+	Recipe string
+
+	// From is the version that was active before the upgrade, To is
+	// empty if there wasn't a newer version to upgrade to.
+	From string
+	To   string
+
+	// Removed are the packages removed because they were beyond the
+	// number of versions to keep.
+	Removed []*Package
+}
+
+// UpgradeRecipe moves a recipe to its newest stable release, or the newest
+// release that satisfies the constraint of the active package, that has
+// an archive for the arch and os. The new version is installed and made
+// active. When keep
+// is more than 0, older packages for the recipe beyond the newest keep are
+// removed. Packages with a version constraint are never removed.
+func (c *Config) UpgradeRecipe(ctx context.Context, arch, OS, recipeName string, keep int) (*Upgrade, error) {
+	r, ok := c.FindRecipe(recipeName)
+	if !ok {
+		return nil, fmt.Errorf("unknown recipe %q", recipeName)
+	}
+	u := &Upgrade{Recipe: recipeName}
+
+	var active *Package
+	for _, p := range c.Packages {
+		if p.RecipeName == recipeName && p.Active {
+			active = p
+		}
+	}
+	constraint := version.ChannelStable
+	if active != nil && active.Constraint != "" {
+		constraint = active.Constraint
+	}
+	con, err := version.ParseConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := c.RecipeVersions(ctx, r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get versions for %q", recipeName)
+	}
+	if active != nil {
+		u.From = active.Version
+	} else {
+		for _, rv := range versions {
+			if rv.Installed {
+				u.From = rv.Version
+				break
+			}
+		}
+	}
+
+	// Versions are newest first, use the newest version that has an
+	// archive for this platform.
+	for _, rv := range versions {
+		if u.From != "" && version.Compare(rv.Version, u.From) <= 0 {
+			break
+		}
+		if rv.Release == nil && !rv.hasSource(VersionSourceStatic) {
+			continue
+		}
+		if rv.Release != nil && rv.Release.Draft {
+			continue
+		}
+		if isPrerelease(rv.Version, rv.Release) && !con.Prereleases() {
+			continue
+		}
+		if !con.Check(version.Parse(rv.Version)) {
+			continue
+		}
+		available, checked := c.AssetsAvailable(ctx, arch, OS, r, []string{rv.Version})[rv.Version]
+		if !checked {
+			return nil, fmt.Errorf("unable to check for an archive of %s@%s for %s/%s", recipeName, rv.Version, OS, arch)
+		}
+		if !available {
+			logging.DebugLog("%s@%s has no archive for %s/%s, skipping\n", recipeName, rv.Version, OS, arch)
+			continue
+		}
+		u.To = rv.Version
+		break
+	}
+	if u.To == "" {
+		return u, nil
+	}
+
+	// Install the new version before saving the config or pruning older
+	// versions, so that if the install fails, or is cancelled, the
+	// previous version is still installed and active.
+	revert, err := c.activateVersion(ctx, arch, OS, r, active, u.To)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.CreatePackagesForRecipe(ctx, recipeName, arch, OS); err != nil {
+		revert()
+		return nil, err
+	}
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+
+	if keep > 0 {
+		if u.Removed, err = c.prunePackages(recipeName, keep); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+// activateVersion makes v the active version of a recipe, either by
+// resolving the active package's constraint to it or by making the package
+// for v active, adding it if needed. The config isn't saved, the returned
+// func undoes the changes.
+func (c *Config) activateVersion(ctx context.Context, arch, OS string, r Recipe, active *Package, v string) (func(), error) {
+	if _, err := c.getCachedOrDownload(ctx, arch, OS, r, v); err != nil {
+		return nil, err
+	}
+	if active != nil && active.Constraint != "" {
+		previous := active.Version
+		active.Version = v
+		active.iniSection.SetKey("resolved", v)
+		return func() {
+			active.Version = previous
+			active.iniSection.SetKey("resolved", previous)
+		}, nil
+	}
+	p := c.findPackage(r.Name, v)
+	added := p == nil
+	if added {
+		p = &Package{
+			iniSection: c.iniFile.AddSection(fmt.Sprintf("%s@%s", r.Name, v)),
+			RecipeName: r.Name,
+			Version:    v,
+		}
+		c.Packages = append(c.Packages, p)
+	}
+	c.setActive(p)
+	return func() {
+		if added {
+			c.Packages = c.Packages[:len(c.Packages)-1]
+			c.iniFile.RemoveSection(p.iniSection.Name())
+		}
+		if active != nil {
+			c.setActive(active)
+		} else {
+			p.Active = false
+			p.iniSection.RemoveKey("active")
+		}
+	}, nil
+}
+
+// findPackage returns the package for a recipe and exact version.
+func (c *Config) findPackage(recipeName, v string) *Package {
+	for _, p := range c.Packages {
+		if p.RecipeName == recipeName && p.Constraint == "" && version.Equal(p.Version, v) {
+			return p
+		}
+	}
+	return nil
+}
+
+// prunePackages removes all but the newest keep packages for a recipe,
+// never removing the active package or packages with a version
+// constraint.
+func (c *Config) prunePackages(recipeName string, keep int) ([]*Package, error) {
+	var pkgs []*Package
+	for _, p := range c.Packages {
+		if p.RecipeName == recipeName && p.Constraint == "" {
+			pkgs = append(pkgs, p)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return version.IsNewer(pkgs[i].Version, pkgs[j].Version)
+	})
+	var removed []*Package
+	kept := 0
+	for _, p := range pkgs {
+		if kept < keep || p.Active {
+			kept++
+			continue
+		}
+		if err := c.RemovePackage(p); err != nil {
+			return removed, err
+		}
+		removed = append(removed, p)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, c.save()
+}
+
+// RemovePackage removes a package from the config, and its files and
+// symlinks from the install tree. The config isn't saved.
+func (c *Config) RemovePackage(p *Package) error {
+	for i, pkg := range c.Packages {
+		if pkg == p {
+			c.Packages = append(c.Packages[:i], c.Packages[i+1:]...)
+			break
+		}
+	}
+	c.iniFile.RemoveSection(p.iniSection.Name())
+
+	// Another package can be resolved to the same version, in which
+	// case the files are still needed.
+	dir := c.packageDir(p)
+	for _, pkg := range c.Packages {
+		if c.packageDir(pkg) == dir {
+			return nil
+		}
+	}
+	links, err := pacmSymlinks(c.OutputDir)
+	if err != nil {
+		return err
+	}
+	for link, target := range links {
+		if linksInto(link, target, dir) {
+			logging.PrintCommand("remove %s", link)
+			if err := os.Remove(link); err != nil {
+				return err
+			}
+		}
+	}
+	logging.PrintCommand("removeall %s", dir)
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pacmcache "github.com/vishen/pacm/cache"
+)
+
+func TestUpgradeRecipeFailedInstall(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	configData := fmt.Sprintf(`dir=%s
+cache=%s
+[recipe tool]
+url=https://example.invalid/tool-{{.Version}}.tar.gz
+layout=tree
+versions=1.0.0,2.0.0
+[tool@1.0.0]
+active=true
+`, filepath.Join(dir, "bin"), filepath.Join(dir, "cache"))
+	if err := ioutil.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archives, err := pacmcache.LoadCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(v string, b []byte) {
+		if err := archives.WriteArchive(fmt.Sprintf("tool_%s_amd64-linux", v), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("1.0.0", tarGz(t, testEntry{Name: "bin/tool", Body: "1.0.0\n", Mode: 0755}))
+	write("2.0.0", tarGz(t,
+		testEntry{Name: "bin/tool", Body: "2.0.0\n", Mode: 0755},
+		testEntry{Name: "escape", Linkname: "../../../escape"},
+	))
+
+	c, err := LoadWithOptions(ctx, configPath, LoadOptions{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreatePackages(ctx, "amd64", "linux"); err != nil {
+		t.Fatal(err)
+	}
+	tool := filepath.Join(c.OutputDir, "tool")
+	if got := readFile(t, tool); got != "1.0.0\n" {
+		t.Fatalf("tool = %q, want 1.0.0", got)
+	}
+
+	// Installing 2.0.0 fails, which leaves 1.0.0 installed and active.
+	if _, err := c.UpgradeRecipe(ctx, "amd64", "linux", "tool", 1); err == nil {
+		t.Fatal("upgraded to an archive with an escaping symlink")
+	}
+	if got := readFile(t, configPath); got != configData {
+		t.Errorf("config was changed by a failed upgrade:\n%s", got)
+	}
+	if got := readFile(t, tool); got != "1.0.0\n" {
+		t.Errorf("tool = %q after a failed upgrade, want 1.0.0", got)
+	}
+	if len(c.Packages) != 1 || c.Packages[0].Version != "1.0.0" || !c.Packages[0].Active {
+		t.Errorf("got packages %v after a failed upgrade, want tool@1.0.0 active", c.Packages)
+	}
+
+	write("2.0.0", tarGz(t, testEntry{Name: "bin/tool", Body: "2.0.0\n", Mode: 0755}))
+	u, err := c.UpgradeRecipe(ctx, "amd64", "linux", "tool", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.From != "1.0.0" || u.To != "2.0.0" || len(u.Removed) != 1 || u.Removed[0].Version != "1.0.0" {
+		t.Errorf("got upgrade %+v, want 1.0.0 -> 2.0.0 removing 1.0.0", u)
+	}
+	if got := readFile(t, tool); got != "2.0.0\n" {
+		t.Errorf("tool = %q, want 2.0.0", got)
+	}
+	if _, err := os.Stat(filepath.Join(c.OutputDir, "_pacm", "tool_1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("tool 1.0.0 wasn't removed: %v", err)
+	}
+	c, err = LoadWithOptions(ctx, configPath, LoadOptions{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Packages) != 1 || c.Packages[0].Version != "2.0.0" || !c.Packages[0].Active {
+		t.Errorf("got packages %v saved, want tool@2.0.0 active", c.Packages)
+	}
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/vishen/pacm/httpclient"
+	"github.com/vishen/pacm/logging"
+	"github.com/vishen/pacm/releases"
+	"github.com/vishen/pacm/version"
+)
+
+// How many HEAD requests to make at once when checking for assets.
+const assetCheckConcurrency = 8
+
+// Where a version of a recipe is known from.
+const (
+	VersionSourceStatic    = "static"
+	VersionSourceRemote    = "remote"
+	VersionSourceInstalled = "installed"
+)
+
+// RecipeVersion is a version of a recipe and what is known about it.
+type RecipeVersion struct {
+	Version string
+	Sources []string
+
+	Installed bool
+	Active    bool
+
+	// Release is set if the version was found in the recipes release
+	// source.
+	Release *releases.Release
+}
+
+// RecipeVersions merges the versions declared in a recipe, found in its
+// release source and installed, newest first. Failing to look up the
+// release source is returned as an error alongside the other versions.
+func (c *Config) RecipeVersions(ctx context.Context, r Recipe) ([]*RecipeVersion, error) {
+	versions := map[string]*RecipeVersion{}
+	add := func(v, source string) *RecipeVersion {
+		key := version.Parse(v).Normalized()
+		rv, ok := versions[key]
+		if !ok {
+			rv = &RecipeVersion{Version: key}
+			versions[key] = rv
+		}
+		if rv.hasSource(source) {
+			return rv
+		}
+		rv.Sources = append(rv.Sources, source)
+		return rv
+	}
+
+	for _, v := range r.Versions {
+		add(v, VersionSourceStatic)
+	}
+	for _, p := range c.Packages {
+		if p.RecipeName != r.Name || p.Version == "" {
+			continue
+		}
+		rv := add(p.Version, VersionSourceInstalled)
+		rv.Installed = true
+		rv.Active = rv.Active || p.Active
+	}
+
+	var sourceErr error
+	if source, err := r.ReleaseSource(c.ReleasesClient()); err != nil {
+		sourceErr = err
+	} else if source != nil {
+		rels, err := source.Releases(ctx)
+		if err != nil {
+			sourceErr = err
+		}
+		for i := range rels {
+			rv := add(rels[i].TagName, VersionSourceRemote)
+			rv.Release = &rels[i]
+		}
+	}
+
+	list := make([]*RecipeVersion, 0, len(versions))
+	for _, rv := range versions {
+		list = append(list, rv)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return version.IsNewer(list[i].Version, list[j].Version)
+	})
+	return list, sourceErr
+}
+
+// ResolveConstraint returns the newest version of a recipe, from its static
+// versions and release source, that satisfies a constraint or channel.
+// Draft releases are never used, and releases marked as a prerelease are
+// only used if the constraint allows prereleases.
+func (c *Config) ResolveConstraint(ctx context.Context, r Recipe, constraint string) (string, error) {
+	con, err := version.ParseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	versions, err := c.RecipeVersions(ctx, r)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get versions for %q", r.Name)
+	}
+	for _, rv := range versions {
+		if rv.Release == nil && !rv.hasSource(VersionSourceStatic) {
+			continue
+		}
+		if rv.Release != nil && rv.Release.Draft {
+			continue
+		}
+		if isPrerelease(rv.Version, rv.Release) && !con.Prereleases() {
+			continue
+		}
+		if con.Check(version.Parse(rv.Version)) {
+			return rv.Version, nil
+		}
+	}
+	return "", fmt.Errorf("no version of %q satisfies %q", r.Name, constraint)
+}
+
+// isPrerelease reports whether a version is a prerelease, either by its
+// name or by its release being marked as one. rel may be nil.
+func isPrerelease(v string, rel *releases.Release) bool {
+	return version.Parse(v).Prerelease() || (rel != nil && rel.Prerelease)
+}
+
+func (rv *RecipeVersion) hasSource(source string) bool {
+	for _, s := range rv.Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// AssetsAvailable checks whether there is an archive that can be downloaded
+// for each of the versions of a recipe, on the given arch and os. Versions
+// that are already cached are always available. Versions that can't be
+// checked, ie: when offline, are missing from the returned map.
+func (c *Config) AssetsAvailable(ctx context.Context, arch, OS string, r Recipe, versions []string) map[string]bool {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		available = map[string]bool{}
+		sem       = make(chan struct{}, assetCheckConcurrency)
+	)
+	for _, v := range versions {
+		if cache.Archives[c.generateArchivePath(arch, OS, r, v)] {
+			available[v] = true
+			continue
+		}
+		if c.Offline {
+			continue
+		}
+		url, err := r.generateURL(arch, OS, v)
+		if err != nil {
+			logging.DebugLog("unable to generate url for %s@%s: %v\n", r.Name, v, err)
+			continue
+		}
+		wg.Add(1)
+		go func(v, url string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ok, err := assetExists(ctx, url)
+			if err != nil {
+				logging.DebugLog("unable to check %s: %v\n", httpclient.Redact(url), err)
+				return
+			}
+			mu.Lock()
+			available[v] = ok
+			mu.Unlock()
+		}(v, url)
+	}
+	wg.Wait()
+	return available
+}
+
+func assetExists(ctx context.Context, url string) (bool, error) {
+	logging.PrintCommand("HTTP HEAD %s", httpclient.Redact(url))
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := httpclient.Client().Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300, nil
+}
+
+// ReleasesBetween returns the releases of a recipe that are newer than
+// from, up to and including to, newest first. When to is empty it is the
+// newest release, ignoring prereleases unless prereleases is set. Drafts
+// are never returned, and prereleases are only returned if prereleases is
+// set or to is a prerelease.
+func (c *Config) ReleasesBetween(ctx context.Context, r Recipe, from, to string, prereleases bool) ([]releases.Release, error) {
+	source, err := r.ReleaseSource(c.ReleasesClient())
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, fmt.Errorf("recipe %q has no release source", r.Name)
+	}
+	rels, err := source.Releases(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get releases from %s", source)
+	}
+	if to == "" {
+		for _, rel := range rels {
+			if !rel.Draft && (prereleases || !isPrerelease(rel.TagName, &rel)) {
+				to = rel.TagName
+				break
+			}
+		}
+		if to == "" {
+			return nil, fmt.Errorf("no releases found for %q", r.Name)
+		}
+	}
+	// Asking for a prerelease includes the prereleases before it.
+	for i := range rels {
+		if version.Compare(rels[i].TagName, to) == 0 {
+			prereleases = prereleases || isPrerelease(to, &rels[i])
+			break
+		}
+	}
+	prereleases = prereleases || isPrerelease(to, nil)
+
+	var between []releases.Release
+	for _, rel := range rels {
+		if rel.Draft || version.Compare(rel.TagName, to) > 0 {
+			continue
+		}
+		if version.Compare(rel.TagName, from) <= 0 {
+			break
+		}
+		if !prereleases && isPrerelease(rel.TagName, &rel) {
+			continue
+		}
+		between = append(between, rel)
+	}
+	return between, nil
+}
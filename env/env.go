@@ -6,12 +6,11 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"runtime"
 
 	"github.com/vishen/pacm/config"
 )
 
-func Env(conf *config.Config, packages []*config.Package) error {
+func Env(ctx context.Context, conf *config.Config, packages []*config.Package, arch, OS string) error {
 	binPath, err := ioutil.TempDir("", "pacm")
 	if err != nil {
 		return err
@@ -45,7 +44,7 @@ func Env(conf *config.Config, packages []*config.Package) error {
 	}
 	conf.Packages = pkgs
 
-	if err := conf.CreatePackages(runtime.GOARCH, runtime.GOOS); err != nil {
+	if err := conf.CreatePackages(ctx, arch, OS); err != nil {
 		return err
 	}
 
@@ -58,7 +57,6 @@ func Env(conf *config.Config, packages []*config.Package) error {
 		fmt.Sprintf("PACM_PACKAGES=%s", pkgsString),
 	}...)
 
-	ctx := context.Background()
 	cmd := exec.CommandContext(ctx, defaultShell)
 	cmd.Env = environ
 	cmd.Stdout = os.Stdout
@@ -1,10 +1,10 @@
 module github.com/vishen/pacm
 
-go 1.13
+go 1.22
 
 require (
-	github.com/h2non/filetype v1.0.10
 	github.com/hashicorp/go-getter v1.4.1
+	github.com/klauspost/compress v1.18.0
 	github.com/knq/ini v0.0.0-20191206014339-58b5e74713e0
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/olekukonko/tablewriter v0.0.4
@@ -12,4 +12,30 @@ require (
 	github.com/rogpeppe/go-internal v1.5.2
 	github.com/spf13/cobra v0.0.5
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
+)
+
+require (
+	cloud.google.com/go v0.45.1 // indirect
+	github.com/aws/aws-sdk-go v1.15.78 // indirect
+	github.com/bgentry/go-netrc v0.0.0-20140422174119-9fd32a8b3d3d // indirect
+	github.com/golang/protobuf v1.3.2 // indirect
+	github.com/googleapis/gax-go/v2 v2.0.5 // indirect
+	github.com/hashicorp/go-cleanhttp v0.5.0 // indirect
+	github.com/hashicorp/go-safetemp v1.0.0 // indirect
+	github.com/hashicorp/go-version v1.1.0 // indirect
+	github.com/hashicorp/golang-lru v0.5.1 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20160202185014-0b12d6b521d8 // indirect
+	github.com/mattn/go-runewidth v0.0.7 // indirect
+	github.com/mitchellh/go-testing-interface v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.3 // indirect
+	github.com/ulikunitz/xz v0.5.5 // indirect
+	go.opencensus.io v0.22.0 // indirect
+	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45 // indirect
+	golang.org/x/sys v0.0.0-20190624142023-c5567b49c5d0 // indirect
+	golang.org/x/text v0.3.2 // indirect
+	google.golang.org/api v0.9.0 // indirect
+	google.golang.org/genproto v0.0.0-20190819201941-24fa4b261c55 // indirect
+	google.golang.org/grpc v1.21.1 // indirect
+	gopkg.in/errgo.v2 v2.1.0 // indirect
 )
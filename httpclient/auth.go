@@ -0,0 +1,279 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/vishen/pacm/logging"
+)
+
+// Credentials used to authenticate requests to a host. If Token is set
+// it is sent as a bearer token, otherwise Username and Password are sent
+// using basic auth.
+type Credentials struct {
+	Username string
+	Password string
+	Token    string
+
+	// Where the credentials came from, used for logging instead of
+	// the credentials themselves.
+	Source string
+}
+
+// Hosts that share credentials with another host.
+var hostAliases = map[string]string{
+	"api.github.com": "github.com",
+}
+
+// Tokens that are read from the environment for well known hosts.
+var envTokens = map[string]string{
+	"github.com": "GITHUB_TOKEN",
+	"gitlab.com": "GITLAB_TOKEN",
+}
+
+// loadCredentials merges the credentials from ~/.netrc, the config and
+// the environment, in that order of precedence. PACM_TOKEN_<HOST> is read
+// separately by loadHostTokens and takes precedence over all of them.
+func loadCredentials(configured map[string]Credentials) (map[string]Credentials, error) {
+	creds, err := readNetrc()
+	if err != nil {
+		return nil, err
+	}
+	for host, c := range configured {
+		c.Source = fmt.Sprintf("[auth %s]", host)
+		creds[host] = c
+	}
+	for host, env := range envTokens {
+		if v := os.Getenv(env); v != "" {
+			creds[host] = Credentials{Token: v, Source: "$" + env}
+		}
+	}
+	return creds, nil
+}
+
+// loadHostTokens reads the PACM_TOKEN_<HOST> variables, keyed by the
+// <HOST> part, as a host's '.'s and '-'s can't be recovered from it.
+func loadHostTokens() map[string]Credentials {
+	tokens := map[string]Credentials{}
+	for _, e := range os.Environ() {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || kv[1] == "" || !strings.HasPrefix(kv[0], "PACM_TOKEN_") {
+			continue
+		}
+		host := strings.ToUpper(strings.TrimPrefix(kv[0], "PACM_TOKEN_"))
+		tokens[host] = Credentials{Token: kv[1], Source: "$" + kv[0]}
+	}
+	return tokens
+}
+
+// hostTokenKey is the <HOST> part of PACM_TOKEN_<HOST> for a host, which
+// has '.' and '-' replaced with '_', ie: PACM_TOKEN_MY_ARTIFACTS_EXAMPLE_COM
+// for my-artifacts.example.com.
+func hostTokenKey(host string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(host))
+}
+
+func credentialsForHost(host string) (Credentials, bool) {
+	host = strings.ToLower(host)
+	hosts := []string{host}
+	if alias, ok := hostAliases[host]; ok {
+		hosts = append(hosts, alias)
+	}
+	for _, h := range hosts {
+		if c, ok := hostTokens[hostTokenKey(h)]; ok {
+			return c, true
+		}
+		if c, ok := credentials[h]; ok {
+			return c, true
+		}
+	}
+	return Credentials{}, false
+}
+
+func readNetrc() (map[string]Credentials, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]Credentials{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	logging.PrintCommand("read netrc %s", path)
+	return parseNetrc(string(b), path), nil
+}
+
+func parseNetrc(data, source string) map[string]Credentials {
+	creds := map[string]Credentials{}
+	var (
+		machine string
+		current Credentials
+		inMacro bool
+	)
+	flush := func() {
+		if machine != "" {
+			current.Source = source
+			creds[machine] = current
+		}
+		machine = ""
+		current = Credentials{}
+	}
+	for _, line := range strings.Split(data, "\n") {
+		// Macro definitions run until an empty line.
+		if inMacro {
+			if strings.TrimSpace(line) == "" {
+				inMacro = false
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			next := func() string {
+				if i+1 < len(fields) {
+					i++
+					return fields[i]
+				}
+				return ""
+			}
+			switch fields[i] {
+			case "machine":
+				flush()
+				machine = strings.ToLower(next())
+			case "default":
+				flush()
+			case "login":
+				current.Username = next()
+			case "password":
+				current.Password = next()
+			case "account":
+				next()
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	flush()
+	return creds
+}
+
+type authTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Credentials are only sent over https, so they can't be read or
+	// changed on the way.
+	if req.Header.Get("Authorization") != "" || req.URL.Scheme != "https" {
+		return t.rt.RoundTrip(req)
+	}
+	c, ok := credentialsForHost(req.URL.Hostname())
+	if !ok {
+		return t.rt.RoundTrip(req)
+	}
+	logging.DebugLog("using credentials from %s for %s\n", c.Source, req.URL.Hostname())
+	req = req.Clone(req.Context())
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// Redact removes any user information from a url so it is safe to log.
+func Redact(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	u.User = url.User("xxxxx")
+	return u.String()
+}
+
+// githubAPI is where release assets are looked up, it is changed by tests.
+var githubAPI = "https://api.github.com"
+
+// Download makes a GET request for a file. Release assets from private
+// GitHub repositories can't be downloaded from their public url, so when
+// there are credentials for GitHub the asset is downloaded using the
+// GitHub API instead. If the API doesn't know of the release or asset,
+// the public url is used.
+func Download(ctx context.Context, rawurl string) (*http.Response, error) {
+	if u, err := url.Parse(rawurl); err == nil && u.Hostname() == "github.com" {
+		if _, ok := credentialsForHost("api.github.com"); ok {
+			if assetURL, ok, err := githubAssetURL(ctx, u); err != nil {
+				return nil, err
+			} else if ok {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set("Accept", "application/octet-stream")
+				logging.PrintCommand("HTTP GET %s", assetURL)
+				return client.Do(req)
+			}
+		}
+	}
+	return Get(ctx, rawurl)
+}
+
+// githubAssetURL looks up the API url for a release asset url in the form
+// https://github.com/<owner>/<repo>/releases/download/<tag>/<name>.
+func githubAssetURL(ctx context.Context, u *url.URL) (string, bool, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 6 || parts[2] != "releases" || parts[3] != "download" {
+		return "", false, nil
+	}
+	owner, repo, tag, name := parts[0], parts[1], parts[4], parts[5]
+	releaseURL := fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", githubAPI, owner, repo, url.PathEscape(tag))
+	logging.PrintCommand("HTTP GET %s", releaseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releaseURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		logging.DebugLog("no release %s of %s/%s in the GitHub API, using %s\n", tag, owner, repo, Redact(u.String()))
+		return "", false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", false, fmt.Errorf("invalid response code for %s: %d", releaseURL, resp.StatusCode)
+	}
+	release := struct {
+		Assets []struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"assets"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", false, err
+	}
+	for _, a := range release.Assets {
+		if a.Name == name {
+			return a.URL, true, nil
+		}
+	}
+	logging.DebugLog("no asset %q in release %s of %s/%s in the GitHub API, using %s\n", name, tag, owner, repo, Redact(u.String()))
+	return "", false, nil
+}
@@ -0,0 +1,208 @@
+// Package httpclient provides the http.Client that pacm uses for every
+// network request, configured from the global config and the
+// environment.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/vishen/pacm/logging"
+)
+
+// DefaultMaxRedirects is the default for Options.MaxRedirects.
+const DefaultMaxRedirects = 10
+
+// UserAgent is sent with every request.
+var UserAgent = "pacm/dev"
+
+var client = &http.Client{
+	Transport: &userAgentTransport{rt: http.DefaultTransport},
+}
+
+// Credentials for each host, keyed by host name.
+var credentials = map[string]Credentials{}
+
+// Tokens from PACM_TOKEN_<HOST>, keyed by <HOST>.
+var hostTokens = map[string]Credentials{}
+
+// Options configure the shared http client. They are set from keys in the
+// global section of the config and can be overridden by the environment.
+type Options struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+
+	// CAFiles are PEM encoded certificates to trust on top of the
+	// system certificates.
+	CAFiles []string
+
+	// ConnectTimeout is the timeout for establishing a connection,
+	// and Timeout is the timeout for an entire request.
+	ConnectTimeout time.Duration
+	Timeout        time.Duration
+
+	// MaxRedirects is the number of redirects to follow, where 0
+	// doesn't follow any.
+	MaxRedirects int
+
+	// Auth are the credentials for each host from the config.
+	Auth map[string]Credentials
+}
+
+// Configure builds the shared http client from opts, with any
+// environment variables taking precedence.
+func Configure(opts Options) error {
+	if err := opts.applyEnv(); err != nil {
+		return err
+	}
+
+	proxy := httpproxy.Config{
+		HTTPProxy:  opts.HTTPProxy,
+		HTTPSProxy: opts.HTTPSProxy,
+		NoProxy:    opts.NoProxy,
+	}
+	proxyFunc := proxy.ProxyFunc()
+
+	tlsConfig := &tls.Config{}
+	if len(opts.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, f := range opts.CAFiles {
+			logging.PrintCommand("read ca file %s", f)
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			if !pool.AppendCertsFromPEM(b) {
+				return fmt.Errorf("no certificates found in ca file %s", f)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	tlsHandshakeTimeout := 10 * time.Second
+	if opts.ConnectTimeout > 0 {
+		dialer.Timeout = opts.ConnectTimeout
+		tlsHandshakeTimeout = opts.ConnectTimeout
+	}
+	transport := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		},
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	creds, err := loadCredentials(opts.Auth)
+	if err != nil {
+		return err
+	}
+	credentials = creds
+	hostTokens = loadHostTokens()
+
+	if opts.MaxRedirects < 0 {
+		return fmt.Errorf("max redirects can't be negative: %d", opts.MaxRedirects)
+	}
+	maxRedirects := opts.MaxRedirects
+	client = &http.Client{
+		Transport: &userAgentTransport{rt: &authTransport{rt: transport}},
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if maxRedirects == 0 {
+				return fmt.Errorf("not following redirect to %s, redirects are disabled", Redact(req.URL.String()))
+			}
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+	return nil
+}
+
+func (o *Options) applyEnv() error {
+	for _, e := range []struct {
+		dst  *string
+		keys []string
+	}{
+		{&o.HTTPProxy, []string{"HTTP_PROXY", "http_proxy"}},
+		{&o.HTTPSProxy, []string{"HTTPS_PROXY", "https_proxy"}},
+		{&o.NoProxy, []string{"NO_PROXY", "no_proxy"}},
+	} {
+		for _, k := range e.keys {
+			if v := os.Getenv(k); v != "" {
+				*e.dst = v
+				break
+			}
+		}
+	}
+	if v := os.Getenv("PACM_CA_FILES"); v != "" {
+		o.CAFiles = strings.Split(v, ",")
+	}
+	var err error
+	if v := os.Getenv("PACM_CONNECT_TIMEOUT"); v != "" {
+		if o.ConnectTimeout, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid PACM_CONNECT_TIMEOUT %q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("PACM_TIMEOUT"); v != "" {
+		if o.Timeout, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid PACM_TIMEOUT %q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("PACM_MAX_REDIRECTS"); v != "" {
+		if o.MaxRedirects, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid PACM_MAX_REDIRECTS %q: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// Client returns the shared http client.
+func Client() *http.Client {
+	return client
+}
+
+// Get makes a GET request for url with the shared http client.
+func Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+type userAgentTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	return t.rt.RoundTrip(req)
+}
@@ -0,0 +1,87 @@
+// Package lock provides advisory file locks so that multiple pacm
+// processes don't modify the same config, cache or install directory
+// at the same time.
+package lock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vishen/pacm/logging"
+)
+
+const pollInterval = 100 * time.Millisecond
+
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// Acquire takes an exclusive lock on the file at path, creating it if
+// needed. If another process holds the lock, Acquire will keep trying
+// until wait has passed before giving up.
+func Acquire(path string, wait time.Duration) (*Lock, error) {
+	logging.PrintCommand("lock %s", path)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	loggedWait := false
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			break
+		}
+		pid := holder(path)
+		if time.Now().After(deadline) {
+			f.Close()
+			if pid == 0 {
+				return nil, fmt.Errorf("another pacm is running and holds %s", path)
+			}
+			return nil, fmt.Errorf("another pacm is running (pid %d) and holds %s", pid, path)
+		}
+		if !loggedWait {
+			logging.DebugLog("waiting for another pacm (pid %d) to release %s\n", pid, path)
+			loggedWait = true
+		}
+		time.Sleep(pollInterval)
+	}
+
+	// Record who is holding the lock so that other processes can
+	// report it.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	return &Lock{f: f, path: path}, nil
+}
+
+// Release unlocks and closes the lock file.
+func (l *Lock) Release() error {
+	logging.PrintCommand("unlock %s", l.path)
+	if err := unlock(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// holder returns the pid written to the lock file by the process
+// currently holding the lock, or 0 if it is unknown.
+func holder(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return pid
+}
@@ -4,6 +4,10 @@ import (
 	"github.com/vishen/pacm/cmd"
 )
 
+// Set by goreleaser.
+var version = "dev"
+
 func main() {
+	cmd.Version = version
 	cmd.Execute()
 }
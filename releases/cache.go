@@ -0,0 +1,220 @@
+package releases
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/vishen/pacm/httpclient"
+	"github.com/vishen/pacm/logging"
+)
+
+// Client fetches releases, caching the responses on disk so that
+// unchanged responses can be revalidated with an ETag instead of being
+// downloaded again.
+type Client struct {
+	// CacheDir is where responses are cached, caching is disabled
+	// if it is empty.
+	CacheDir string
+
+	// MaxAge is how long a cached response is used before checking
+	// whether it has changed.
+	MaxAge time.Duration
+
+	// Offline only uses cached responses, no matter how old they are.
+	Offline bool
+}
+
+type cachedResponse struct {
+	URL       string      `json:"url"`
+	ETag      string      `json:"etag"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body"`
+	FetchedAt time.Time   `json:"fetched_at"`
+}
+
+type response struct {
+	header http.Header
+	body   []byte
+
+	// Whether the response came from the cache without making a request.
+	cached bool
+}
+
+func (c *Client) cachePath(url string) string {
+	return filepath.Join(c.CacheDir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(url))))
+}
+
+func (c *Client) loadCached(url string) *cachedResponse {
+	if c.CacheDir == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(c.cachePath(url))
+	if err != nil {
+		return nil
+	}
+	cr := &cachedResponse{}
+	if err := json.Unmarshal(b, cr); err != nil || cr.URL != url {
+		return nil
+	}
+	return cr
+}
+
+func (c *Client) saveCached(cr *cachedResponse) {
+	if c.CacheDir == "" {
+		return
+	}
+	b, err := json.Marshal(cr)
+	if err != nil {
+		return
+	}
+	logging.PrintCommand("mkdirall %s 0755", c.CacheDir)
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		logging.ErrorLog("unable to cache response for %s: %v", cr.URL, err)
+		return
+	}
+	if err := writeFileAtomic(c.cachePath(cr.URL), b); err != nil {
+		logging.ErrorLog("unable to cache response for %s: %v", cr.URL, err)
+	}
+}
+
+// writeFileAtomic writes to a temporary file that is renamed to path, so
+// that another pacm never reads a partially written response.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".response-")
+	if err != nil {
+		return err
+	}
+	logging.PrintCommand("writefile %s 0644", tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	logging.PrintCommand("rename %s -> %s", tmp.Name(), path)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// paginate makes GET requests starting at url and following any "next"
+// links in the Link header, calling fn with each page.
+func (c *Client) paginate(ctx context.Context, url string, header http.Header, checkResponse func(*http.Response) error, fn func(*response) error) error {
+	for url != "" {
+		res, err := c.get(ctx, url, header, checkResponse)
+		if err != nil {
+			return err
+		}
+		if err := fn(res); err != nil {
+			return err
+		}
+		url = ""
+		if m := linkNext.FindStringSubmatch(res.header.Get("Link")); m != nil {
+			url = m[1]
+		}
+	}
+	return nil
+}
+
+// checkAPIResponse returns the error message from a json api response
+// in the form {"message": "..."}.
+func checkAPIResponse(res *http.Response) error {
+	body, _ := ioutil.ReadAll(res.Body)
+	apiErr := struct {
+		Message interface{} `json:"message"`
+	}{}
+	json.Unmarshal(body, &apiErr)
+	if apiErr.Message != nil {
+		return fmt.Errorf("%s returned %d: %v", res.Request.URL, res.StatusCode, apiErr.Message)
+	}
+	return nil
+}
+
+// get makes a GET request for url, using the cached response if it is
+// still fresh or unchanged. checkResponse is called for responses that
+// aren't successful, and should return an error describing the failure.
+func (c *Client) get(ctx context.Context, url string, header http.Header, checkResponse func(*http.Response) error) (*response, error) {
+	cached := c.loadCached(url)
+	if c.Offline {
+		if cached == nil {
+			return nil, fmt.Errorf("%s not in cache (offline mode)", url)
+		}
+		return &response{header: cached.Header, body: cached.Body, cached: true}, nil
+	}
+	if cached != nil && time.Since(cached.FetchedAt) < c.MaxAge {
+		logging.DebugLog("using cached response for %s\n", url)
+		return &response{header: cached.Header, body: cached.Body, cached: true}, nil
+	}
+
+	logging.PrintCommand("HTTP GET %s", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	res, err := httpclient.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		logging.DebugLog("%s not modified, using cached response\n", url)
+		cached.FetchedAt = time.Now()
+		c.saveCached(cached)
+		// Keep the cached headers, ie: pagination links, but use any
+		// new values from the not modified response.
+		header := http.Header{}
+		for k, v := range cached.Header {
+			header[k] = v
+		}
+		for k, v := range res.Header {
+			header[k] = v
+		}
+		return &response{header: header, body: cached.Body}, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		if checkResponse != nil {
+			if err := checkResponse(res); err != nil {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf("invalid response code for %s: %d", url, res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.saveCached(&cachedResponse{
+		URL:       url,
+		ETag:      res.Header.Get("ETag"),
+		Header:    res.Header,
+		Body:      body,
+		FetchedAt: time.Now(),
+	})
+	return &response{header: res.Header, body: body}, nil
+}
@@ -0,0 +1,113 @@
+package releases
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// releasesServer serves two pages of GitHub releases with ETags, counting
+// the requests and not modified responses for each page.
+func releasesServer(t *testing.T) (*httptest.Server, map[string]int, map[string]int) {
+	t.Helper()
+	requests := map[string]int{}
+	notModified := map[string]int{}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		requests[page]++
+		etag := fmt.Sprintf(`"page-%s"`, page)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified[page]++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		switch page {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/releases?page=2>; rel="next", <%s/releases?page=2>; rel="last"`, srv.URL, srv.URL))
+			fmt.Fprint(w, `[{"tag_name": "v1.1.0"}, {"tag_name": "v1.0.0"}]`)
+		case "2":
+			fmt.Fprint(w, `[{"tag_name": "v1.2.0"}, {"tag_name": "v0.9.0"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests, notModified
+}
+
+func tagNames(releases []Release) []string {
+	var names []string
+	for _, r := range releases {
+		names = append(names, r.TagName)
+	}
+	return names
+}
+
+func TestGithubReleasesPagination(t *testing.T) {
+	srv, requests, _ := releasesServer(t)
+	c := &Client{}
+	releases, err := c.githubReleasesFromURL(context.Background(), srv.URL+"/releases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"v1.2.0", "v1.1.0", "v1.0.0", "v0.9.0"}
+	if got := tagNames(releases); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if requests[""] != 1 || requests["2"] != 1 {
+		t.Errorf("got requests %v, want one for each page", requests)
+	}
+}
+
+func TestGithubReleasesNotModified(t *testing.T) {
+	srv, requests, notModified := releasesServer(t)
+	c := &Client{CacheDir: t.TempDir()}
+	want := []string{"v1.2.0", "v1.1.0", "v1.0.0", "v0.9.0"}
+	for i := 0; i < 2; i++ {
+		releases, err := c.githubReleasesFromURL(context.Background(), srv.URL+"/releases")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The second page is only found from the cached Link header.
+		if got := tagNames(releases); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: got %v, want %v", i, got, want)
+		}
+	}
+	if requests[""] != 2 || requests["2"] != 2 {
+		t.Errorf("got requests %v, want two for each page", requests)
+	}
+	if notModified[""] != 1 || notModified["2"] != 1 {
+		t.Errorf("got not modified responses %v, want one for each page", notModified)
+	}
+
+	// Nothing but the cached responses are left in the cache.
+	files, err := ioutil.ReadDir(c.CacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") || strings.HasPrefix(f.Name(), ".") {
+			t.Errorf("unexpected file %s in the cache", f.Name())
+		}
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d cached responses, want 2", len(files))
+	}
+
+	// Fresh responses are used without a request.
+	c.MaxAge = time.Hour
+	if _, err := c.githubReleasesFromURL(context.Background(), srv.URL+"/releases"); err != nil {
+		t.Fatal(err)
+	}
+	if requests[""] != 2 || requests["2"] != 2 {
+		t.Errorf("got requests %v, want the fresh responses to be used", requests)
+	}
+}
@@ -0,0 +1,173 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vishen/pacm/version"
+)
+
+type jsonSource struct {
+	client *Client
+	url    string
+	path   string
+	regex  *regexp.Regexp
+}
+
+// JSON returns a source that pulls version strings out of a json document
+// at url. path is a '.' separated list of object keys, array indexes, or
+// '*' to match every element of an array or value of an object, ie:
+// "versions.*.version". If regex is set, the version is the first capture
+// group of the regex matched against each value.
+func (c *Client) JSON(url, path, regex string) (Source, error) {
+	s := &jsonSource{client: c, url: url, path: path}
+	if regex != "" {
+		var err error
+		if s.regex, err = regexp.Compile(regex); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *jsonSource) String() string {
+	return "json:" + s.url
+}
+
+func (s *jsonSource) Releases(ctx context.Context) ([]Release, error) {
+	res, err := s.client.get(ctx, s.url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(res.body, &doc); err != nil {
+		return nil, err
+	}
+	values, err := jsonPath(doc, s.path)
+	if err != nil {
+		return nil, err
+	}
+	versions := []string{}
+	for _, v := range values {
+		var str string
+		switch t := v.(type) {
+		case string:
+			str = t
+		case float64:
+			str = strconv.FormatFloat(t, 'f', -1, 64)
+		default:
+			continue
+		}
+		versions = append(versions, str)
+	}
+	return versionReleases(versions, s.regex), nil
+}
+
+// jsonPath returns all the values in doc matching path.
+func jsonPath(doc interface{}, path string) ([]interface{}, error) {
+	values := []interface{}{doc}
+	if path == "" {
+		return values, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		next := []interface{}{}
+		for _, v := range values {
+			switch t := v.(type) {
+			case map[string]interface{}:
+				if key == "*" {
+					for _, mv := range t {
+						next = append(next, mv)
+					}
+				} else if mv, ok := t[key]; ok {
+					next = append(next, mv)
+				}
+			case []interface{}:
+				if key == "*" {
+					next = append(next, t...)
+				} else if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(t) {
+					next = append(next, t[i])
+				}
+			}
+		}
+		values = next
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("nothing found at path %q", path)
+	}
+	return values, nil
+}
+
+type indexSource struct {
+	client *Client
+	url    string
+	regex  *regexp.Regexp
+}
+
+// Index returns a source that scrapes versions from a page at url, ie: a
+// directory listing. The version is the first capture group of regex, or
+// the whole match if there are no capture groups.
+func (c *Client) Index(url, regex string) (Source, error) {
+	if regex == "" {
+		return nil, fmt.Errorf("a regex is needed to find versions in %s", url)
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	return &indexSource{client: c, url: url, regex: re}, nil
+}
+
+func (s *indexSource) String() string {
+	return "index:" + s.url
+}
+
+func (s *indexSource) Releases(ctx context.Context) ([]Release, error) {
+	res, err := s.client.get(ctx, s.url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	versions := []string{}
+	for _, m := range s.regex.FindAllStringSubmatch(string(res.body), -1) {
+		if len(m) > 1 {
+			versions = append(versions, m[1])
+		} else {
+			versions = append(versions, m[0])
+		}
+	}
+	return versionReleases(versions, nil), nil
+}
+
+// versionReleases turns a list of version strings into releases, removing
+// any duplicates. If regex is set only the first capture group is kept.
+func versionReleases(versions []string, regex *regexp.Regexp) []Release {
+	seen := map[string]bool{}
+	releases := []Release{}
+	for _, v := range versions {
+		if regex != nil {
+			m := regex.FindStringSubmatch(v)
+			if m == nil {
+				continue
+			}
+			if len(m) > 1 {
+				v = m[1]
+			} else {
+				v = m[0]
+			}
+		}
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		releases = append(releases, Release{
+			TagName:    v,
+			Name:       v,
+			Prerelease: version.Parse(v).Prerelease(),
+		})
+	}
+	sortReleases(releases)
+	return releases
+}
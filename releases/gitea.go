@@ -0,0 +1,47 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type giteaSource struct {
+	client  *Client
+	baseURL string
+	repo    string
+}
+
+// Gitea returns a source for the releases of a repository on a Gitea or
+// Forgejo instance at baseURL, repo is in the form <owner>/<repo>.
+func (c *Client) Gitea(baseURL, repo string) Source {
+	return &giteaSource{client: c, baseURL: strings.TrimSuffix(baseURL, "/"), repo: strings.Trim(repo, "/")}
+}
+
+func (s *giteaSource) String() string {
+	return "gitea:" + s.baseURL + "/" + s.repo
+}
+
+func (s *giteaSource) Releases(ctx context.Context) ([]Release, error) {
+	if s.baseURL == "" {
+		return nil, fmt.Errorf("no url set for gitea repository %q", s.repo)
+	}
+	// The Gitea releases api uses the same fields as GitHub.
+	u := fmt.Sprintf("%s/api/v1/repos/%s/releases?limit=50", s.baseURL, s.repo)
+
+	releases := []Release{}
+	err := s.client.paginate(ctx, u, nil, checkAPIResponse, func(res *response) error {
+		page := []Release{}
+		if err := json.Unmarshal(res.body, &page); err != nil {
+			return err
+		}
+		releases = append(releases, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortReleases(releases)
+	return releases, nil
+}
@@ -0,0 +1,122 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vishen/pacm/logging"
+)
+
+const (
+	// https://api.github.com/repos/kubernetes/kubernetes/releases
+	githubReleaseURL = "https://api.github.com/repos/%s/%s/releases"
+
+	githubPerPage = 100
+)
+
+type githubSource struct {
+	client *Client
+	repo   string
+}
+
+// Github returns a source for the releases of a GitHub repository, repo
+// is in the form <owner>/<repo>.
+func (c *Client) Github(repo string) Source {
+	return &githubSource{client: c, repo: repo}
+}
+
+func (s *githubSource) String() string {
+	return "github:" + s.repo
+}
+
+func (s *githubSource) Releases(ctx context.Context) ([]Release, error) {
+	return s.client.GithubReleases(ctx, s.repo)
+}
+
+// githubRepo returns the owner and repo from either <owner>/<repo> or a
+// GitHub API releases url.
+func githubRepo(repo string) (string, string, error) {
+	repo = strings.TrimPrefix(repo, "https://api.github.com/repos/")
+	repo = strings.TrimPrefix(repo, "https://github.com/")
+	repo = strings.TrimSuffix(repo, "/releases")
+	parts := strings.Split(strings.Trim(repo, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%q is not a github repository, expected <owner>/<repo>", repo)
+	}
+	return parts[0], parts[1], nil
+}
+
+// GithubReleases returns all the releases for a GitHub repository, repo
+// is in the form <owner>/<repo>.
+func (c *Client) GithubReleases(ctx context.Context, repo string) ([]Release, error) {
+	owner, name, err := githubRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf(githubReleaseURL, owner, name) + fmt.Sprintf("?per_page=%d", githubPerPage)
+	return c.githubReleasesFromURL(ctx, url)
+}
+
+func (c *Client) githubReleasesFromURL(ctx context.Context, url string) ([]Release, error) {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github.v3+json")
+
+	releases := []Release{}
+	err := c.paginate(ctx, url, header, checkGithubResponse, func(res *response) error {
+		if !res.cached {
+			logGithubRateLimit(res.header)
+		}
+		page := []Release{}
+		if err := json.Unmarshal(res.body, &page); err != nil {
+			return err
+		}
+		releases = append(releases, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortReleases(releases)
+	return releases, nil
+}
+
+// checkGithubResponse turns an unsuccessful GitHub API response into an
+// error, making it clear when the rate limit has been hit.
+func checkGithubResponse(res *http.Response) error {
+	body, _ := ioutil.ReadAll(res.Body)
+	apiErr := struct {
+		Message string `json:"message"`
+	}{}
+	json.Unmarshal(body, &apiErr)
+
+	if (res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusTooManyRequests) &&
+		res.Header.Get("X-RateLimit-Remaining") == "0" {
+		return fmt.Errorf("github rate limit exceeded, resets at %s (set GITHUB_TOKEN to raise the limit)", githubRateLimitReset(res.Header).Format(time.RFC1123))
+	}
+	if apiErr.Message != "" {
+		return fmt.Errorf("github returned %d for %s: %s", res.StatusCode, res.Request.URL, apiErr.Message)
+	}
+	return nil
+}
+
+func logGithubRateLimit(header http.Header) {
+	remaining := header.Get("X-RateLimit-Remaining")
+	if remaining == "" {
+		return
+	}
+	logging.DebugLog("github rate limit: %s/%s remaining, resets at %s\n", remaining, header.Get("X-RateLimit-Limit"), githubRateLimitReset(header).Format(time.RFC1123))
+	if n, err := strconv.Atoi(remaining); err == nil && n < 10 {
+		logging.ErrorLog("only %d github api requests remaining, resets at %s", n, githubRateLimitReset(header).Format(time.RFC1123))
+	}
+}
+
+func githubRateLimitReset(header http.Header) time.Time {
+	reset, _ := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	return time.Unix(reset, 0)
+}
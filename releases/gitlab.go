@@ -0,0 +1,75 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultGitlabURL = "https://gitlab.com"
+
+type gitlabSource struct {
+	client  *Client
+	baseURL string
+	project string
+}
+
+// Gitlab returns a source for the releases of a GitLab project, project
+// is in the form <group>/<project>. baseURL is the url of a self-hosted
+// GitLab, or empty for gitlab.com.
+func (c *Client) Gitlab(baseURL, project string) Source {
+	if baseURL == "" {
+		baseURL = defaultGitlabURL
+	}
+	return &gitlabSource{client: c, baseURL: strings.TrimSuffix(baseURL, "/"), project: strings.Trim(project, "/")}
+}
+
+func (s *gitlabSource) String() string {
+	if s.baseURL == defaultGitlabURL {
+		return "gitlab:" + s.project
+	}
+	return "gitlab:" + s.baseURL + "/" + s.project
+}
+
+func (s *gitlabSource) Releases(ctx context.Context) ([]Release, error) {
+	// https://docs.gitlab.com/ee/api/releases/
+	u := fmt.Sprintf("%s/api/v4/projects/%s/releases?per_page=100", s.baseURL, url.PathEscape(s.project))
+
+	releases := []Release{}
+	err := s.client.paginate(ctx, u, nil, checkAPIResponse, func(res *response) error {
+		page := []struct {
+			TagName         string    `json:"tag_name"`
+			Name            string    `json:"name"`
+			Description     string    `json:"description"`
+			CreatedAt       time.Time `json:"created_at"`
+			ReleasedAt      time.Time `json:"released_at"`
+			UpcomingRelease bool      `json:"upcoming_release"`
+			Commit          struct {
+				ID string `json:"id"`
+			} `json:"commit"`
+		}{}
+		if err := json.Unmarshal(res.body, &page); err != nil {
+			return err
+		}
+		for _, r := range page {
+			releases = append(releases, Release{
+				TagName:         r.TagName,
+				TargetCommitish: r.Commit.ID,
+				Name:            r.Name,
+				Prerelease:      r.UpcomingRelease,
+				CreatedAt:       r.CreatedAt,
+				PublishedAt:     r.ReleasedAt,
+				Body:            r.Description,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortReleases(releases)
+	return releases, nil
+}
@@ -0,0 +1,93 @@
+package releases
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	mdComment  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	mdAutolink = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+	mdHTMLTag  = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdImage    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdCode     = regexp.MustCompile("`+([^`]+)`+")
+	mdBold     = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	mdItalic   = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:[^*_]*?\S)?)[*_]($|[^\w*])`)
+	mdHeading  = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)[\s#]*$`)
+	mdList     = regexp.MustCompile(`^(\s*)[*+-]\s+`)
+	mdEscape   = regexp.MustCompile(`\\([\\` + "`" + `*_{}\[\]()#+\-.!<>])`)
+	mdBlank    = regexp.MustCompile(`\n{3,}`)
+)
+
+// Notes returns the release notes as plain text, with the markdown used
+// by most forges stripped so that they can be read in a terminal.
+func (r Release) Notes() string {
+	return PlainText(r.Body)
+}
+
+// PlainText strips markdown from s. Headings are underlined, links are
+// written as "text (url)" and code blocks are indented.
+func PlainText(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = mdComment.ReplaceAllString(s, "")
+
+	var (
+		out     []string
+		inFence bool
+	)
+	for _, line := range strings.Split(s, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			out = append(out, "    "+line)
+			continue
+		}
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			text := plainTextInline(m[2])
+			underline := "-"
+			if len(m[1]) == 1 {
+				underline = "="
+			}
+			out = append(out, text, strings.Repeat(underline, len([]rune(text))))
+			continue
+		}
+		line = mdList.ReplaceAllString(line, "$1- ")
+		out = append(out, plainTextInline(line))
+	}
+	s = strings.Join(out, "\n")
+	s = mdBlank.ReplaceAllString(s, "\n\n")
+	return strings.TrimRight(strings.TrimLeft(s, "\n"), " \n")
+}
+
+// escapeBase is the start of a unicode private use area, escaped
+// characters are moved there while the rest of the markdown is stripped.
+const escapeBase = 0xE000
+
+func plainTextInline(s string) string {
+	s = mdEscape.ReplaceAllStringFunc(s, func(e string) string {
+		return string(rune(escapeBase + int(e[1])))
+	})
+	s = mdAutolink.ReplaceAllString(s, "$1")
+	s = mdHTMLTag.ReplaceAllString(s, "")
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllStringFunc(s, func(l string) string {
+		m := mdLink.FindStringSubmatch(l)
+		if m[1] == m[2] {
+			return m[2]
+		}
+		return m[1] + " (" + m[2] + ")"
+	})
+	s = mdCode.ReplaceAllString(s, "$1")
+	s = mdBold.ReplaceAllString(s, "$1$2")
+	s = mdItalic.ReplaceAllString(s, "$1$2$3")
+	return strings.Map(func(r rune) rune {
+		if r >= escapeBase && r < escapeBase+128 {
+			return r - escapeBase
+		}
+		return r
+	}, s)
+}
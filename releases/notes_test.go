@@ -0,0 +1,23 @@
+package releases
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"## Breaking Changes\r\n\r\n* **cli**: `-var-file` now _requires_ a file", "Breaking Changes\n----------------\n\n- cli: -var-file now requires a file"},
+		{"# v1.0.0\n", "v1.0.0\n======"},
+		{"See [#123](https://github.com/o/r/pull/123) and <https://example.com>", "See #123 (https://github.com/o/r/pull/123) and https://example.com"},
+		{"![logo](https://x/logo.png)<br/>done", "logodone"},
+		{"```sh\n$ pacm *ensure*\n```", "    $ pacm *ensure*"},
+		{"keep snake_case_names and 2*3*4", "keep snake_case_names and 2*3*4"},
+		{"a\n\n\n\n<!-- comment -->\nb", "a\n\nb"},
+		{"\\*not italic\\*", "*not italic*"},
+	}
+	for _, tt := range tests {
+		if got := PlainText(tt.in); got != tt.want {
+			t.Errorf("PlainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -1,21 +1,16 @@
 package releases
 
 import (
-	"encoding/json"
-	"net/http"
+	"context"
 	"sort"
 	"time"
 
-	"github.com/vishen/pacm/logging"
-	"github.com/vishen/pacm/utils"
+	"github.com/vishen/pacm/version"
 )
 
-const (
-	// https://api.github.com/repos/kubernetes/kubernetes/releases
-	githubReleaseURL = "https://api.github.com/repos/%s/%s/releases"
-)
-
-type GithubRelease struct {
+// Release is a single release of a recipe. The fields match the GitHub
+// releases api, other sources are converted to it.
+type Release struct {
 	TagName         string    `json:"tag_name"`
 	TargetCommitish string    `json:"target_commitish"`
 	Name            string    `json:"name"`
@@ -26,22 +21,19 @@ type GithubRelease struct {
 	Body            string    `json:"body"`
 }
 
-func GithubReleases(url string) ([]GithubRelease, error) {
-	logging.PrintCommand("HTTP GET %s", url)
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
+// Source is somewhere that releases can be looked up from.
+type Source interface {
+	// String describes the source, ie: github:hashicorp/terraform.
+	String() string
+
+	// Releases returns all the releases, newest first.
+	Releases(ctx context.Context) ([]Release, error)
+}
 
-	releases := []GithubRelease{}
-	if err := json.NewDecoder(res.Body).Decode(&releases); err != nil {
-		return nil, err
-	}
+func sortReleases(releases []Release) {
 	sort.Slice(releases, func(i, j int) bool {
 		ri := releases[i].TagName
 		rj := releases[j].TagName
-		return utils.SemvarIsBigger(ri, rj)
+		return version.IsNewer(ri, rj)
 	})
-	return releases, nil
 }
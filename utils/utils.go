@@ -5,10 +5,9 @@ import (
 	"debug/macho"
 	"fmt"
 	"io"
-	"runtime"
+	"math"
 	"strconv"
 	"strings"
-	"unicode"
 
 	"github.com/vishen/pacm/logging"
 )
@@ -34,6 +33,32 @@ func StringBool(str string) (bool, error) {
 	return false, fmt.Errorf("%q is not a boolean value", str)
 }
 
+// ParseSize parses a size in bytes, with an optional K, M, G or T suffix
+// for multiples of 1024, ie: "512M", "4GB" or "1GiB".
+func ParseSize(str string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(str))
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	multiplier := int64(-1)
+	switch unit := strings.TrimSpace(s[i:]); unit {
+	case "", "B":
+		multiplier = 1
+	default:
+		for j, prefix := range []string{"K", "M", "G", "T"} {
+			if unit == prefix || unit == prefix+"B" || unit == prefix+"IB" {
+				multiplier = 1 << (10 * uint(j+1))
+			}
+		}
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil || multiplier < 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("%q is not a size", str)
+	}
+	return n * multiplier, nil
+}
+
 func IsValidOSArchPair(value string) bool {
 	// TODO: Is this the best way to split the <os>_<arch> with a '_'??
 	osAndArch := strings.Split(value, "_")
@@ -60,7 +85,23 @@ func IsValidOSArchPair(value string) bool {
 	return true
 }
 
+// ParsePlatform splits a platform in the form <os>/<arch> and checks
+// that it is a valid os and arch pair.
+func ParsePlatform(platform string) (string, string, error) {
+	osAndArch := strings.Split(platform, "/")
+	if len(osAndArch) != 2 || !IsValidOSArchPair(osAndArch[0]+"_"+osAndArch[1]) {
+		return "", "", fmt.Errorf("%q is not a valid platform, expected <os>/<arch>", platform)
+	}
+	return osAndArch[0], osAndArch[1], nil
+}
+
 func ShouldExtract(path string, extractPaths []string) bool {
+	return CheckPathInPaths(path, ExtractPaths(extractPaths))
+}
+
+// ExtractPaths returns the non-empty extractPaths, or the default paths
+// to search for binaries if there aren't any.
+func ExtractPaths(extractPaths []string) []string {
 	// Filter out any empty paths.
 	shouldExtractPaths := []string{}
 	for _, p := range extractPaths {
@@ -71,7 +112,7 @@ func ShouldExtract(path string, extractPaths []string) bool {
 	if len(shouldExtractPaths) == 0 {
 		shouldExtractPaths = defaultExtractPaths
 	}
-	return CheckPathInPaths(path, shouldExtractPaths)
+	return shouldExtractPaths
 }
 
 func ShouldExtractLibrary(path string, libraryPaths []string) bool {
@@ -97,6 +138,15 @@ func CheckPathInPaths(path string, paths []string) bool {
 	return inPath
 }
 
+// MatchingPath returns the first of paths that path is in.
+func MatchingPath(path string, paths []string) (string, bool) {
+	inPath, index := checkPathInPaths(path, paths)
+	if !inPath {
+		return "", false
+	}
+	return paths[index], true
+}
+
 func checkPathInPaths(path string, paths []string) (bool, int) {
 	// TODO: There is likely a much better way to do this.
 	pathSplit := strings.Split(path, "/")
@@ -122,11 +172,30 @@ func checkPathInPaths(path string, paths []string) (bool, int) {
 	return inPaths, index
 }
 
-func IsExecutable(r io.ReaderAt) bool {
-	currentArch := runtime.GOARCH
-	currentOS := runtime.GOOS
-	logging.DebugLog("is exec for arch=%s os=%s\n", currentArch, currentOS)
-	switch currentOS {
+// The machine of ELF and Mach-O executables for each arch.
+var (
+	elfArchs = map[string]elf.Machine{
+		"386":   elf.EM_386,
+		"amd64": elf.EM_X86_64,
+		"arm":   elf.EM_ARM,
+		"arm64": elf.EM_AARCH64,
+		"mips":  elf.EM_MIPS,
+		"ppc64": elf.EM_PPC64,
+	}
+	machoArchs = map[string]macho.Cpu{
+		"386":   macho.Cpu386,
+		"amd64": macho.CpuAmd64,
+		"arm":   macho.CpuArm,
+		"arm64": macho.CpuArm64,
+		"ppc64": macho.CpuPpc64,
+	}
+)
+
+// IsExecutable checks whether r is an executable that can be run on the
+// target arch and os.
+func IsExecutable(r io.ReaderAt, arch, OS string) bool {
+	logging.DebugLog("is exec for arch=%s os=%s\n", arch, OS)
+	switch OS {
 	case "darwin":
 		m, err := macho.NewFile(r)
 		if err != nil {
@@ -137,18 +206,8 @@ func IsExecutable(r io.ReaderAt) bool {
 		if m.Type != macho.TypeExec {
 			return false
 		}
-		switch currentArch {
-		case "386":
-			return m.Cpu == macho.Cpu386
-		case "amd64":
-			return m.Cpu == macho.CpuAmd64
-		case "arm":
-			return m.Cpu == macho.CpuArm
-		case "arm64":
-			return m.Cpu == macho.CpuArm64
-		case "ppc64":
-			return m.Cpu == macho.CpuPpc64
-		}
+		cpu, ok := machoArchs[arch]
+		return ok && m.Cpu == cpu
 	case "linux", "dragonfly", "freebsd", "openbsd", "solaris", "netbsd":
 		e, err := elf.NewFile(r)
 		if err != nil {
@@ -161,66 +220,33 @@ func IsExecutable(r io.ReaderAt) bool {
 			return false
 		}
 
-		switch currentArch {
-		case "386":
-			return e.Machine == elf.EM_386
-		case "amd64":
-			return e.Machine == elf.EM_X86_64
-		case "arm":
-			return e.Machine == elf.EM_ARM
-		case "arm64":
-			return e.Machine == elf.EM_AARCH64
-		case "mips":
-			return e.Machine == elf.EM_MIPS
-		case "ppc64":
-			return e.Machine == elf.EM_PPC64
-		}
-	default:
-		logging.ErrorLog("unsupported OS %q\n", currentOS)
-		return false
+		machine, ok := elfArchs[arch]
+		return ok && e.Machine == machine
 	}
+	logging.ErrorLog("unsupported OS %q\n", OS)
 	return false
 }
 
-func SemvarIsBigger(semvar1, semvar2 string) bool {
-	s1 := strings.SplitN(semvar1, ".", 3)
-	s2 := strings.SplitN(semvar2, ".", 3)
-
-	for i := 0; i < 3; i++ {
-		s1i := s1[i]
-		s2i := s2[i]
-		s1in, s1OnlyNumber := extractFirstNumber(s1i)
-		s2in, s2OnlyNumber := extractFirstNumber(s2i)
-		if s1in == s2in {
-			if s1OnlyNumber && !s2OnlyNumber {
-				return true
-			} else if s2OnlyNumber && !s1OnlyNumber {
-				return false
+// BinaryFormat describes the executable format and arch of r, ie:
+// "elf amd64", or returns an empty string if it isn't an executable.
+func BinaryFormat(r io.ReaderAt) string {
+	if e, err := elf.NewFile(r); err == nil {
+		arch := e.Machine.String()
+		for name, machine := range elfArchs {
+			if e.Machine == machine {
+				arch = name
 			}
-			continue
-		}
-		if s1in < s2in {
-			return false
-		} else if s1in > s2in {
-			return true
 		}
+		return "elf " + arch
 	}
-	return semvar1 > semvar2
-}
-
-func extractFirstNumber(s string) (int, bool) {
-	start := 0
-	end := len(s)
-	isDigit := false
-	for i, c := range s {
-		if !isDigit && unicode.IsDigit(c) {
-			isDigit = true
-			start = i
-		} else if isDigit && !unicode.IsDigit(c) {
-			end = i
-			break
+	if m, err := macho.NewFile(r); err == nil {
+		arch := m.Cpu.String()
+		for name, cpu := range machoArchs {
+			if m.Cpu == cpu {
+				arch = name
+			}
 		}
+		return "mach-o " + arch
 	}
-	val, _ := strconv.Atoi(s[start:end])
-	return val, len(s) == len(s[start:end])
+	return ""
 }
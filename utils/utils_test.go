@@ -0,0 +1,35 @@
+package utils
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"4k", 4 << 10},
+		{"512M", 512 << 20},
+		{"4GB", 4 << 30},
+		{"1GiB", 1 << 30},
+		{" 2 T ", 2 << 40},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.size)
+		if err != nil {
+			t.Errorf("ParseSize(%q): %v", tt.size, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+
+	for _, size := range []string{"", "G", "-1", "4I", "4KI", "4X", "1.5G", "4 G B", "9223372036854775807K", "99999999999999999999"} {
+		if got, err := ParseSize(size); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", size, got)
+		}
+	}
+}
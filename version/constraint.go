@@ -0,0 +1,271 @@
+package version
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Channels that can be used in place of a constraint.
+const (
+	// ChannelLatest matches any release, including prereleases.
+	ChannelLatest = "latest"
+	// ChannelStable matches any release that isn't a prerelease.
+	ChannelStable = "stable"
+)
+
+// Constraint is a range of versions, ie: ~0.12, >=1.14 <1.16, ^2.1 || 3.x,
+// or one of the channels latest and stable.
+//
+// Comparators separated by spaces (or commas) must all match and sets of
+// comparators separated by || are alternatives. The supported comparators
+// are:
+//
+//	=1.2.3 !=1.2.3 >1.2.3 >=1.2.3 <1.2.3 <=1.2.3
+//	~1.2.3  >=1.2.3 <1.3.0 (~1.2 and ~1 allow the next minor or major)
+//	^1.2.3  >=1.2.3 <2.0.0 (^0.2.3 is <0.3.0 and ^0.0.3 is <0.0.4)
+//	1.2.x   >=1.2.0 <1.3.0 (x, X and * are all wildcards)
+//
+// Prereleases only match a constraint that mentions a prerelease, or the
+// latest channel.
+type Constraint struct {
+	original string
+	channel  string
+
+	alternatives [][]comparator
+	prereleases  bool
+}
+
+type comparator struct {
+	op      string
+	version Version
+}
+
+// IsConstraint reports whether s is a constraint or channel rather than a
+// single version.
+func IsConstraint(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == ChannelLatest || s == ChannelStable {
+		return true
+	}
+	if strings.ContainsAny(s, "<>=!~^*|, ") {
+		return true
+	}
+	for _, p := range strings.Split(s, ".") {
+		if isWildcard(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseConstraint parses a constraint or channel.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{original: strings.TrimSpace(s)}
+	if c.original == ChannelLatest || c.original == ChannelStable {
+		c.channel = c.original
+		return c, nil
+	}
+	if c.original == "" {
+		return c, fmt.Errorf("empty version constraint")
+	}
+	for _, alt := range strings.Split(c.original, "||") {
+		var comparators []comparator
+		fields := strings.Fields(strings.Replace(alt, ",", " ", -1))
+		for i := 0; i < len(fields); i++ {
+			f := fields[i]
+			// Allow a space between the operator and the version,
+			// ie: ">= 1.14".
+			if strings.Trim(f, "<>=!~^") == "" && i+1 < len(fields) {
+				i++
+				f += fields[i]
+			}
+			cs, err := parseComparator(f)
+			if err != nil {
+				return c, fmt.Errorf("invalid version constraint %q: %v", s, err)
+			}
+			comparators = append(comparators, cs...)
+			// Only the versions as written, not the upper bounds of
+			// ranges, allow prereleases.
+			if Parse(strings.TrimLeft(f, "<>=!~^")).Prerelease() {
+				c.prereleases = true
+			}
+		}
+		if len(comparators) == 0 {
+			return c, fmt.Errorf("invalid version constraint %q: empty alternative", s)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+	return c, nil
+}
+
+func parseComparator(s string) ([]comparator, error) {
+	var op string
+	for _, o := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(s, o) {
+			op = o
+			break
+		}
+	}
+	rest := strings.TrimPrefix(s, op)
+	if rest == "" {
+		return nil, fmt.Errorf("missing version after %q", op)
+	}
+
+	// Wildcards are turned into a range that covers the parts before
+	// the wildcard.
+	parts := strings.Split(normalize(rest), ".")
+	for i, p := range parts {
+		if !isWildcard(p) {
+			continue
+		}
+		if op != "" && op != "=" {
+			return nil, fmt.Errorf("wildcard %q can't be used with %q", s, op)
+		}
+		if i == 0 {
+			return []comparator{{op: "*"}}, nil
+		}
+		return tildeRange(strings.Join(parts[:i], "."))
+	}
+
+	switch op {
+	case "~":
+		return tildeRange(rest)
+	case "^":
+		return caretRange(rest)
+	case "":
+		op = "="
+	}
+	v := Parse(rest)
+	if v.Normalized() == "" {
+		return nil, fmt.Errorf("invalid version %q", rest)
+	}
+	return []comparator{{op: op, version: v}}, nil
+}
+
+func isWildcard(s string) bool {
+	return s == "x" || s == "X" || s == "*"
+}
+
+// tildeRange allows changes to the last part given, but at least the
+// minor version, ie: ~1.2.3 is >=1.2.3 <1.3.0, ~1.2 is >=1.2 <1.3 and ~1
+// is >=1 <2.
+func tildeRange(s string) ([]comparator, error) {
+	v, err := parseRangeVersion(s)
+	if err != nil {
+		return nil, err
+	}
+	upper := make([]int, len(v.parts))
+	copy(upper, v.parts)
+	if len(upper) == 1 {
+		upper[0]++
+	} else {
+		upper = upper[:2]
+		upper[1]++
+	}
+	return bounded(v, upper), nil
+}
+
+// caretRange allows changes that don't modify the left most non-zero part,
+// ie: ^1.2.3 is >=1.2.3 <2.0.0, ^0.2.3 is >=0.2.3 <0.3.0.
+func caretRange(s string) ([]comparator, error) {
+	v, err := parseRangeVersion(s)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	for i < len(v.parts)-1 && v.parts[i] == 0 {
+		i++
+	}
+	upper := make([]int, i+1)
+	copy(upper, v.parts[:i+1])
+	upper[i]++
+	return bounded(v, upper), nil
+}
+
+func parseRangeVersion(s string) (Version, error) {
+	v := Parse(s)
+	if !v.IsSemver() {
+		return v, fmt.Errorf("%q is not a semantic version", s)
+	}
+	return v, nil
+}
+
+func bounded(lower Version, upper []int) []comparator {
+	u := Version{semver: true, parts: upper}
+	strs := make([]string, len(upper))
+	for i, p := range upper {
+		strs[i] = fmt.Sprintf("%d", p)
+	}
+	u.original = strings.Join(strs, ".")
+	// The upper bound is exclusive of its prereleases, ie: ~1.2 shouldn't
+	// match 1.3.0-rc1, so compare against the lowest possible prerelease.
+	u.prerelease = []string{"0"}
+	return []comparator{
+		{op: ">=", version: lower},
+		{op: "<", version: u},
+	}
+}
+
+// String returns the constraint as it was written.
+func (c Constraint) String() string {
+	return c.original
+}
+
+// Channel returns the channel, latest or stable, if the constraint is a
+// channel.
+func (c Constraint) Channel() string {
+	return c.channel
+}
+
+// Prereleases reports whether the constraint can match prereleases.
+func (c Constraint) Prereleases() bool {
+	return c.channel == ChannelLatest || c.prereleases
+}
+
+// Check reports whether v satisfies the constraint.
+func (c Constraint) Check(v Version) bool {
+	switch c.channel {
+	case ChannelLatest:
+		return true
+	case ChannelStable:
+		return !v.Prerelease()
+	}
+	if v.Prerelease() && !c.prereleases {
+		return false
+	}
+	for _, alt := range c.alternatives {
+		matched := true
+		for _, cmp := range alt {
+			if !cmp.check(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmp comparator) check(v Version) bool {
+	if cmp.op == "*" {
+		return true
+	}
+	c := v.Compare(cmp.version)
+	switch cmp.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
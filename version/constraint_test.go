@@ -0,0 +1,95 @@
+package version
+
+import "testing"
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"latest", "1.0.0-rc1", true},
+		{"stable", "1.0.0-rc1", false},
+		{"stable", "1.0.0", true},
+		{"~0.12", "0.12.29", true},
+		{"~0.12", "v0.12.0", true},
+		{"~0.12", "0.13.0", false},
+		{"~0.12", "0.11.14", false},
+		{"~0.12", "0.13.0-rc1", false},
+		{"~0.12", "0.12.5-rc1", false},
+		{"^1.2", "1.3.0-rc1", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.2.2", false},
+		{"~1", "1.9.0", true},
+		{"~1", "2.0.0", false},
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{">=1.14 <1.16", "1.15.3", true},
+		{">=1.14 <1.16", "1.16.0", false},
+		{">=1.14 <1.16", "1.13.9", false},
+		{">= 1.14, < 1.16", "1.14.0", true},
+		{"1.14.x", "1.14.2", true},
+		{"1.14.x", "1.15.0", false},
+		{"*", "3.0.0", true},
+		{"~0.11 || ~0.12", "0.11.3", true},
+		{"~0.11 || ~0.12", "0.13.0", false},
+		{"!=1.2.3", "1.2.3", false},
+		{">=1.0.0-rc1", "1.0.0-rc2", true},
+		{">=1.0.0", "1.1.0-rc1", false},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %v", tt.constraint, err)
+		}
+		if got := c.Check(Parse(tt.version)); got != tt.want {
+			t.Errorf("%q.Check(%q) = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestConstraintPrereleases(t *testing.T) {
+	tests := map[string]bool{
+		"latest":      true,
+		"stable":      false,
+		"~0.12":       false,
+		">=1.0.0-rc1": true,
+	}
+	for constraint, want := range tests {
+		c, err := ParseConstraint(constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %v", constraint, err)
+		}
+		if got := c.Prereleases(); got != want {
+			t.Errorf("%q.Prereleases() = %v, want %v", constraint, got, want)
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, s := range []string{"", ">=", "~abc", "^1.x", ">=1.14 ||"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) expected an error", s)
+		}
+	}
+}
+
+func TestIsConstraint(t *testing.T) {
+	tests := map[string]bool{
+		"1.14.0":       false,
+		"v0.12.0-rc1":  false,
+		"latest":       true,
+		"stable":       true,
+		"~0.12":        true,
+		">=1.14 <1.16": true,
+		"1.14.x":       true,
+	}
+	for s, want := range tests {
+		if got := IsConstraint(s); got != want {
+			t.Errorf("IsConstraint(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
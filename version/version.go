@@ -0,0 +1,232 @@
+// Package version parses and compares the versions of packages.
+//
+// Versions are compared using SemVer 2.0 precedence where possible, with
+// any number of numeric parts (ie: 1.14, 2020.01.15 or 2020-01-15), an
+// optional leading 'v' and prereleases without a '-' (ie: 1.14rc1). Versions that aren't semver are compared by splitting them
+// into runs of digits and non-digits, so that calendar or otherwise odd
+// versions still have a sensible order.
+package version
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	dateVersion        = regexp.MustCompile(`^\d+(-\d+)+$`)
+	attachedPrerelease = regexp.MustCompile(`^(\d+)((?i:alpha|beta|rc|pre|preview|dev)\.?\d*)$`)
+)
+
+type Version struct {
+	original string
+
+	// Whether the version could be parsed as a semantic version, the
+	// rest of the fields are only set if it could.
+	semver     bool
+	parts      []int
+	prerelease []string
+	build      string
+}
+
+// Parse parses a version, it never fails, versions that aren't semantic
+// versions fall back to a natural string ordering.
+func Parse(s string) Version {
+	v := Version{original: s}
+	rest := normalize(s)
+
+	if i := strings.Index(rest, "+"); i >= 0 {
+		v.build = rest[i+1:]
+		rest = rest[:i]
+	}
+	// Dates, ie: 2020-01-15, are versions and not prereleases of 2020.
+	if dateVersion.MatchString(rest) {
+		rest = strings.Replace(rest, "-", ".", -1)
+	}
+	var prerelease string
+	if i := strings.Index(rest, "-"); i >= 0 {
+		prerelease = rest[i+1:]
+		rest = rest[:i]
+		if prerelease == "" {
+			return v
+		}
+	}
+	if rest == "" {
+		return v
+	}
+	parts := strings.Split(rest, ".")
+	for i, p := range parts {
+		// The prerelease can follow the last part without a '-', ie:
+		// 1.14rc1.
+		if m := attachedPrerelease.FindStringSubmatch(p); m != nil && i == len(parts)-1 && prerelease == "" {
+			p, prerelease = m[1], m[2]
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{original: s}
+		}
+		v.parts = append(v.parts, n)
+	}
+	if prerelease != "" {
+		v.prerelease = strings.Split(prerelease, ".")
+	}
+	v.semver = true
+	return v
+}
+
+func normalize(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 1 && (s[0] == 'v' || s[0] == 'V') && unicode.IsDigit(rune(s[1])) {
+		s = s[1:]
+	}
+	return s
+}
+
+// String returns the version as it was originally written.
+func (v Version) String() string {
+	return v.original
+}
+
+// Normalized returns the version without a leading 'v'.
+func (v Version) Normalized() string {
+	return normalize(v.original)
+}
+
+// IsSemver reports whether the version is a semantic version.
+func (v Version) IsSemver() bool {
+	return v.semver
+}
+
+// Prerelease reports whether the version is a prerelease, ie: 1.0.0-rc1.
+func (v Version) Prerelease() bool {
+	return len(v.prerelease) > 0
+}
+
+// Parts returns the numeric parts of a semantic version.
+func (v Version) Parts() []int {
+	return v.parts
+}
+
+// Compare returns -1, 0 or 1 if v is older, the same as, or newer than o.
+// Build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	if !v.semver || !o.semver {
+		return compareNatural(v.Normalized(), o.Normalized())
+	}
+	for i := 0; i < len(v.parts) || i < len(o.parts); i++ {
+		if c := compareInt(part(v.parts, i), part(o.parts, i)); c != 0 {
+			return c
+		}
+	}
+	// A version without a prerelease is newer than one with.
+	switch {
+	case len(v.prerelease) == 0 && len(o.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(o.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(o.prerelease); i++ {
+		if c := comparePrereleaseIdentifier(v.prerelease[i], o.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(v.prerelease), len(o.prerelease))
+}
+
+func part(parts []int, i int) int {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return 0
+}
+
+// comparePrereleaseIdentifier compares numeric identifiers numerically and
+// numeric identifiers are older than alphanumeric ones. Alphanumeric
+// identifiers are compared naturally, so that beta2 is older than beta10.
+func comparePrereleaseIdentifier(a, b string) int {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareInt(an, bn)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return compareNatural(a, b)
+}
+
+// compareNatural compares strings by splitting them into runs of digits
+// and non-digits, comparing the digits numerically.
+func compareNatural(a, b string) int {
+	ac, bc := chunks(a), chunks(b)
+	for i := 0; i < len(ac) && i < len(bc); i++ {
+		an, aErr := strconv.Atoi(ac[i])
+		bn, bErr := strconv.Atoi(bc[i])
+		var c int
+		if aErr == nil && bErr == nil {
+			c = compareInt(an, bn)
+		} else {
+			c = strings.Compare(ac[i], bc[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(ac), len(bc))
+}
+
+func chunks(s string) []string {
+	var (
+		out     []string
+		current []rune
+		digits  bool
+	)
+	for _, r := range s {
+		isDigit := unicode.IsDigit(r)
+		if len(current) > 0 && isDigit != digits {
+			out = append(out, string(current))
+			current = nil
+		}
+		digits = isDigit
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		out = append(out, string(current))
+	}
+	return out
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Compare returns -1, 0 or 1 if a is older, the same as, or newer than b.
+func Compare(a, b string) int {
+	return Parse(a).Compare(Parse(b))
+}
+
+// IsNewer reports whether a is newer than b. When a and b are the same
+// version they are ordered by how they are written, so that sorting is
+// stable.
+func IsNewer(a, b string) bool {
+	if c := Compare(a, b); c != 0 {
+		return c > 0
+	}
+	return a > b
+}
+
+// Equal reports whether a and b are the same version, ie: v1.2.0 and 1.2.0.
+func Equal(a, b string) bool {
+	return Compare(a, b) == 0
+}
@@ -0,0 +1,89 @@
+package version
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"v1.0.0", "1.0.0", 0},
+		{"1.14", "1.14.0", 0},
+		{"1.0.0+build.1", "1.0.0+build.2", 0},
+		{"1.14", "1.9.1", 1},
+		{"0.12.0", "0.11.14", 1},
+		{"2.0.0", "10.0.0", -1},
+		{"1.0.0-rc1", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta2", "1.0.0-beta10", -1},
+		{"1.0.0-rc.1", "1.0.0-beta.11", 1},
+		{"2020.01", "2019.12", 1},
+		{"2020.01.15", "2020.1.2", 1},
+		{"r10", "r9", 1},
+		{"nightly-20200102", "nightly-20200101", 1},
+		{"2020-01-15", "2020-01-02", 1},
+		{"2020-02-01", "2020-01-15", 1},
+		{"2020-01-15", "2020.1.15", 0},
+		{"1.14rc1", "1.14", -1},
+		{"1.14rc2", "1.14rc1", 1},
+		{"1.14beta1", "1.14rc1", -1},
+		{"1.14rc1", "1.14.0-rc1", 0},
+		{"1.14rc1", "1.13.5", 1},
+		{"1.1.1a", "1.1.1", 1},
+	}
+	for _, tt := range tests {
+		if got := Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := Compare(tt.b, tt.a); got != -tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in         string
+		normalized string
+		semver     bool
+		prerelease bool
+	}{
+		{"v1.2.3", "1.2.3", true, false},
+		{"1.2.3-rc.1+abc", "1.2.3-rc.1+abc", true, true},
+		{"1.14", "1.14", true, false},
+		{"version", "version", false, false},
+		{"1.2.x", "1.2.x", false, false},
+		{"1.0.0-", "1.0.0-", false, false},
+		{"2020-01-15", "2020-01-15", true, false},
+		{"v1.14rc1", "1.14rc1", true, true},
+		{"1.14RC1", "1.14RC1", true, true},
+		{"1.14rc", "1.14rc", true, true},
+		{"1.1.1a", "1.1.1a", false, false},
+		{"1.14rc1.2", "1.14rc1.2", false, false},
+	}
+	for _, tt := range tests {
+		v := Parse(tt.in)
+		if v.Normalized() != tt.normalized || v.IsSemver() != tt.semver || v.Prerelease() != tt.prerelease {
+			t.Errorf("Parse(%q) = normalized %q, semver %v, prerelease %v", tt.in, v.Normalized(), v.IsSemver(), v.Prerelease())
+		}
+	}
+}
+
+func TestSortIsNewer(t *testing.T) {
+	versions := []string{"0.11.0", "v0.12.0-alpha1", "0.12.0", "1.2", "0.12.0-rc1", "0.11.14"}
+	want := []string{"1.2", "0.12.0", "0.12.0-rc1", "v0.12.0-alpha1", "0.11.14", "0.11.0"}
+	sort.Slice(versions, func(i, j int) bool {
+		return IsNewer(versions[i], versions[j])
+	})
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Fatalf("sorted = %v, want %v", versions, want)
+		}
+	}
+}